@@ -0,0 +1,140 @@
+package bdog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AggregateFunctions lists the functions that can be used in aggregate
+// queries. sum and avg require numeric columns, and count also accepts "*"
+// to count rows instead of non-NULL values.
+var AggregateFunctions = []string{"count", "sum", "avg", "min", "max"}
+
+// Aggregate is an aggregate function applied to a column.
+type Aggregate struct {
+	Func   string
+	Column string
+}
+
+// Name returns the name of the aggregated value in results,
+// e.g. "avg_elevation_ft", or just "count" for a count of rows.
+func (a Aggregate) Name() string {
+	if a.Column == "*" {
+		return a.Func
+	}
+	return a.Func + "_" + a.Column
+}
+
+// aggregatePrefix is added to the names of aggregated values in queries.
+const aggregatePrefix = "_agg_"
+
+// AggregateAlias returns the name used for an aggregated value in queries,
+// e.g. "_agg_count". It is also used in results if a grouped column has the
+// same name as the aggregate.
+func AggregateAlias(name string) string {
+	return aggregatePrefix + name
+}
+
+// AggregateRow renames the aggregated values in a row of results from their
+// AggregateAlias to their Name, unless a grouped column has the same name.
+func AggregateRow(row map[string]interface{}) {
+	for alias, val := range row {
+		if !strings.HasPrefix(alias, aggregatePrefix) {
+			continue
+		}
+		name := alias[len(aggregatePrefix):]
+		if _, clash := row[name]; !clash {
+			row[name] = val
+			delete(row, alias)
+		}
+	}
+}
+
+// ParseAggregate parses an aggregate given as "func:column", e.g. "avg:elevation_ft",
+// validating the function name and the column name and type.
+func (t *Table) ParseAggregate(s string) (Aggregate, error) {
+	i := strings.IndexByte(s, ':')
+	if i == -1 {
+		return Aggregate{}, fmt.Errorf("%w: invalid aggregate '%s'", ErrInvalidFilter, s)
+	}
+	a := Aggregate{Func: strings.ToLower(s[:i]), Column: s[i+1:]}
+
+	switch a.Func {
+	case "count":
+		if a.Column == "*" {
+			return a, nil
+		}
+	case "sum", "avg", "min", "max":
+	default:
+		return a, fmt.Errorf("%w: unknown aggregate function '%s' (available: %s)",
+			ErrInvalidFilter, a.Func, strings.Join(AggregateFunctions, ", "))
+	}
+	if !t.HasColumn(a.Column) {
+		return a, fmt.Errorf("%w: unknown column '%s'", ErrInvalidFilter, a.Column)
+	}
+	ct := t.ColumnInfo[a.Column].Type
+	if (a.Func == "sum" || a.Func == "avg") && ct != IntegerType && ct != RealType {
+		return a, fmt.Errorf("%w: %s requires a numeric column, '%s' is %s", ErrInvalidFilter, a.Func, a.Column, ct)
+	}
+	if ct == BlobType {
+		return a, fmt.Errorf("%w: cannot aggregate binary column '%s'", ErrInvalidFilter, a.Column)
+	}
+	return a, nil
+}
+
+// AggregateClauses builds the select list and the GROUP BY and ORDER BY
+// clauses (including the leading " GROUP BY ", or empty if there is no
+// grouping) for the "_group" and "_aggregate" options, along with the
+// ColumnInfo for each result value. Rows are counted if no aggregates are
+// given. Aggregated values are selected using their AggregateAlias, so that
+// they can't clash with grouped columns (see AggregateRow).
+func (t *Table) AggregateClauses(opts map[string][]string) (string, string, map[string]ColumnInfo, error) {
+	info := make(map[string]ColumnInfo)
+	var groups, sel []string
+	for _, g := range opts["_group"] {
+		for _, col := range strings.Split(g, ",") {
+			if !t.HasColumn(col) {
+				return "", "", nil, fmt.Errorf("%w: unknown column '%s'", ErrInvalidFilter, col)
+			}
+			if _, dup := info[col]; dup {
+				continue
+			}
+			groups = append(groups, col)
+			info[col] = t.ColumnInfo[col]
+		}
+	}
+	sel = append(sel, groups...)
+
+	aggs := opts["_aggregate"]
+	if len(aggs) == 0 {
+		aggs = []string{"count:*"}
+	}
+	for _, s := range aggs {
+		a, err := t.ParseAggregate(s)
+		if err != nil {
+			return "", "", nil, err
+		}
+		name := AggregateAlias(a.Name())
+		if _, dup := info[name]; dup {
+			continue
+		}
+
+		switch a.Func {
+		case "count":
+			info[name] = ColumnInfo{SQLType: "INTEGER", Type: IntegerType}
+		case "avg":
+			info[name] = ColumnInfo{SQLType: "REAL", Type: RealType}
+		default:
+			ci := t.ColumnInfo[a.Column]
+			info[name] = ColumnInfo{SQLType: ci.SQLType, Type: ci.Type}
+		}
+
+		sel = append(sel, fmt.Sprintf("%s(%s) AS %s", strings.ToUpper(a.Func), a.Column, name))
+	}
+
+	if len(groups) == 0 {
+		return strings.Join(sel, ", "), "", info, nil
+	}
+	groupBy := strings.Join(groups, ", ")
+	return strings.Join(sel, ", "), " GROUP BY " + groupBy + " ORDER BY " + groupBy, info, nil
+}
@@ -143,6 +143,12 @@ func (c *Cardinality) String() string {
 	return strings.Join(lines, "\n")
 }
 
+// ColumnStats returns the statistics for a column of a table, if it was analyzed.
+func (c *Cardinality) ColumnStats(table, column string) (ColStats, bool) {
+	cs, ok := c.cols[table][column]
+	return cs, ok
+}
+
 func NewCardinality(m bdog.Model) (*Cardinality, error) {
 	tabNames := m.ListTableNames()
 	c := &Cardinality{
@@ -2,12 +2,14 @@ package main
 
 import (
 	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 
+	"github.com/pbnjay/bdog"
 	"github.com/pbnjay/bdog/analyzer"
 	"github.com/pbnjay/bdog/controller"
 	"github.com/pbnjay/bdog/drivers"
@@ -25,6 +27,12 @@ func main() {
 	sslCert := flag.String("s", "", "TLS `certificate.pem` for serving requests")
 	sslKey := flag.String("k", "", "TLS `privateKey.pem` for serving requests")
 	readOnly := flag.Bool("ro", false, "do not create write/delete endpoints")
+	exportRows := flag.Int("xr", 0, "maximum `rows` per page for CSV/TSV exports (default is the same as JSON)")
+	exportAll := flag.Bool("xa", false, "allow exporting all rows at once (_perpage=all) in NDJSON/CSV/TSV formats (requires -tp)")
+	showJunctions := flag.Bool("sj", false, "create routes for many-to-many junction tables (hidden by default)")
+	includeDepth := flag.Int("id", 2, "maximum `depth` of nested include paths (e.g. include=region.country is 2)")
+	treeDepth := flag.Int("td", bdog.DefaultTreeDepth, "maximum `depth` of _ancestors and _descendants results (requires MySQL 8.0+ or MariaDB 10.2+)")
+	distinctAll := flag.Bool("da", false, "allow distinct values and grouped aggregates of all columns (not just low-cardinality columns)")
 	verbose := flag.Bool("L", false, "enable verbose logging")
 	flag.Parse()
 
@@ -37,6 +45,10 @@ func main() {
 		fmt.Fprintln(os.Stderr, "You must provide a database to connect to!")
 		os.Exit(1)
 	}
+	if err := checkExportAll(*exportAll, *tokenPassword); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
 	model, err := drivers.Init(dbName)
 	if err != nil {
@@ -58,6 +70,13 @@ func main() {
 		os.Exit(3)
 	}
 	c.ReadOnly = *readOnly
+	c.Cardinality = cards
+	c.DistinctAllColumns = *distinctAll
+	c.MaxIncludeDepth = *includeDepth
+	c.ShowJunctionTables = *showJunctions
+	c.MaxTreeDepth = *treeDepth
+	c.ExportMaxPerPage = *exportRows
+	c.ExportAll = *exportAll
 
 	if *tokenPassword != "" {
 		log.Println("Generating token encryption key...")
@@ -86,3 +105,12 @@ func main() {
 		fmt.Fprintln(os.Stderr, err)
 	}
 }
+
+// checkExportAll returns an error if exporting all rows at once is allowed
+// without token authorization, as anyone could then export entire tables.
+func checkExportAll(exportAll bool, tokenPassword string) error {
+	if exportAll && tokenPassword == "" {
+		return errors.New("-xa requires token authorization (-tp)")
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestCheckExportAll(t *testing.T) {
+	for _, tc := range []struct {
+		exportAll     bool
+		tokenPassword string
+		wantErr       bool
+	}{
+		{false, "", false},
+		{false, "secret", false},
+		{true, "secret", false},
+		{true, "", true},
+	} {
+		err := checkExportAll(tc.exportAll, tc.tokenPassword)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("checkExportAll(%v, %q) = %v, want error: %v", tc.exportAll, tc.tokenPassword, err, tc.wantErr)
+		}
+	}
+}
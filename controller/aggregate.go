@@ -0,0 +1,296 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pbnjay/bdog"
+	"github.com/pbnjay/bdog/analyzer"
+)
+
+// aggregateParameters describes the grouping and aggregate function options,
+// where results can only be grouped by the groups columns.
+func aggregateParameters(tab bdog.Table, groups []string) []APIParameter {
+	var numeric []string
+	for _, cn := range tab.Columns {
+		ct := tab.ColumnInfo[cn].Type
+		if ct == bdog.IntegerType || ct == bdog.RealType {
+			numeric = append(numeric, cn)
+		}
+	}
+	noExplode := false
+	columnList := func(name, desc string, cols []string) APIParameter {
+		return APIParameter{
+			Name:        name,
+			In:          "query",
+			Description: desc,
+			Schema: APISchemaType{
+				Type:  "array",
+				Items: &APISchemaType{Type: "string", Enum: cols},
+			},
+			Style:   "form",
+			Explode: &noExplode,
+		}
+	}
+	var res []APIParameter
+	if len(groups) > 0 {
+		res = append(res, columnList(aggregateParameterName(tab, "group"), "Comma-separated fields to group results by", groups))
+	}
+	return append(res,
+		columnList(aggregateParameterName(tab, "count"), "Count rows (*) or non-empty values of the comma-separated fields, returned as count or count_<field>",
+			append([]string{"*"}, tab.Columns...)),
+		columnList(aggregateParameterName(tab, "sum"), "Sum the comma-separated fields, returned as sum_<field>", numeric),
+		columnList(aggregateParameterName(tab, "avg"), "Average the comma-separated fields, returned as avg_<field>", numeric),
+		columnList(aggregateParameterName(tab, "min"), "Minimum value of the comma-separated fields, returned as min_<field>", tab.Columns),
+		columnList(aggregateParameterName(tab, "max"), "Maximum value of the comma-separated fields, returned as max_<field>", tab.Columns),
+	)
+}
+
+// aggregateParameterName is the query parameter used for the grouping option
+// ("group") or an aggregate function (e.g. "count"), which is prefixed with
+// "_" if the table has a column with the same name, so it can be filtered.
+func aggregateParameterName(tab bdog.Table, name string) string {
+	if tab.HasColumn(name) {
+		return "_" + name
+	}
+	return name
+}
+
+// aggregateOptions moves the grouping and aggregate function parameters in
+// the URL query into opts, so that the rest can be used as listing filters.
+func aggregateOptions(tab bdog.Table, uq map[string][]string, opts map[string][]string) {
+	groupName := aggregateParameterName(tab, "group")
+	if group, ok := uq[groupName]; ok {
+		opts["_group"] = group
+		delete(uq, groupName)
+	}
+	for _, fn := range bdog.AggregateFunctions {
+		name := aggregateParameterName(tab, fn)
+		for _, val := range uq[name] {
+			if fn == "count" && val == "" {
+				val = "*"
+			}
+			for _, col := range strings.Split(val, ",") {
+				opts["_aggregate"] = append(opts["_aggregate"], fn+":"+col)
+			}
+		}
+		delete(uq, name)
+	}
+}
+
+// Aggregate creates an "_aggregate" GET endpoint for the table, returning
+// counts and other aggregates of the (optionally grouped) listing results.
+func (c *Controller) Aggregate(table string) {
+	tab := c.getTable(table)
+	agg, ok := tab.Driver.(bdog.Aggregator)
+	if !ok {
+		return
+	}
+
+	// grouping lists each value, so is limited like "_distinct"
+	groups := c.distinctColumns(tab)
+	allowed := make(map[string]struct{}, len(groups))
+	for _, col := range groups {
+		allowed[col] = struct{}{}
+	}
+
+	route := "/" + tab.PluralName(false) + "/_aggregate"
+	log.Println("GET", route)
+	apiAgg := c.apiSpec.NewHandler("GET", route)
+	apiAgg.Summary = "Aggregate " + tab.PluralName(true)
+	apiAgg.Description = "Returns counts and other aggregates (e.g. `group=iso_country&count=*&avg=elevation_ft`). " +
+		"Each result contains the group fields and the aggregated values, which are prefixed with _agg_ " +
+		"if a group field has the same name (e.g. _agg_count when grouping by a count field). " +
+		"The group and aggregate parameters are prefixed with _ for tables with fields of the same name " +
+		"(e.g. _count=* if there is a count field). " + filterDescription
+	apiAgg.Parameters = append(apiAgg.Parameters, aggregateParameters(tab, groups)...)
+	// only _page and _perpage apply, as results are grouped
+	apiAgg.Parameters = append(apiAgg.Parameters, paginationParameters(tab)[:2]...)
+	apiAgg.Parameters = append(apiAgg.Parameters, filterParameter)
+	if tab.IsSearchable() {
+		apiAgg.Parameters = append(apiAgg.Parameters, searchParameter)
+	}
+
+	example, err := agg.Aggregate(tab, nil)
+	if err == nil {
+		apiAgg.AddExampleResponse(apiAgg.Summary, example)
+	}
+
+	c.metaRouter.GET(route, func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		if c.CORSEnabled {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		opts := make(map[string][]string)
+		uq := r.URL.Query()
+		aggregateOptions(tab, uq, opts)
+		for _, g := range opts["_group"] {
+			for _, col := range strings.Split(g, ",") {
+				if _, ok := allowed[col]; ok || !tab.HasColumn(col) {
+					// unknown columns are reported by the driver
+					continue
+				}
+				if len(groups) == 0 {
+					detailedError(w, http.StatusBadRequest,
+						fmt.Errorf("%s cannot be grouped", tab.PluralName(true)))
+					return
+				}
+				detailedError(w, http.StatusBadRequest,
+					fmt.Errorf("grouping is only available for: %s", strings.Join(groups, ", ")))
+				return
+			}
+		}
+		listingOptions(tab, uq, opts)
+
+		data, err := agg.Aggregate(tab, opts)
+		if err != nil {
+			log.Println(err)
+			if errors.Is(err, bdog.ErrInvalidFilter) {
+				detailedError(w, http.StatusBadRequest, err)
+				return
+			}
+			basicError(w, http.StatusInternalServerError)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(data)
+		if err != nil {
+			log.Println(err)
+			basicError(w, http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// distinctColumns returns the columns of the table which can be used with
+// the "_distinct" endpoint.
+func (c *Controller) distinctColumns(tab bdog.Table) []string {
+	var res []string
+	for _, col := range tab.Columns {
+		if tab.ColumnInfo[col].Type == bdog.BlobType {
+			continue
+		}
+		if !c.DistinctAllColumns {
+			if c.Cardinality == nil {
+				return nil
+			}
+			cs, ok := c.Cardinality.ColumnStats(tab.Name, col)
+			if !ok || cs.UniqueClass != analyzer.ClassValues {
+				continue
+			}
+		}
+		res = append(res, col)
+	}
+	return res
+}
+
+// Distinct creates a "_distinct" GET endpoint for the table, listing the
+// distinct values of a column (with counts) in the listing results.
+func (c *Controller) Distinct(table string) {
+	tab := c.getTable(table)
+	agg, ok := tab.Driver.(bdog.Aggregator)
+	if !ok {
+		return
+	}
+	columns := c.distinctColumns(tab)
+	if len(columns) == 0 {
+		return
+	}
+	allowed := make(map[string]struct{}, len(columns))
+	for _, col := range columns {
+		allowed[col] = struct{}{}
+	}
+
+	route := "/" + tab.PluralName(false) + "/_distinct/:column"
+	log.Println("GET", route)
+	apiDistinct := c.apiSpec.NewHandler("GET", route)
+	apiDistinct.Summary = "List distinct values of a " + tab.SingleName(true) + " field"
+	apiDistinct.Description = "Returns each value with the number of matching " + tab.PluralName(true) +
+		", ordered by value. " + filterDescription
+	for i, p := range apiDistinct.Parameters {
+		if p.In == "path" {
+			p.Schema.Enum = columns
+			p.Example = columns[0]
+			apiDistinct.Parameters[i] = p
+		}
+	}
+	apiDistinct.Parameters = append(apiDistinct.Parameters, APIParameter{
+		Name:        "_perpage",
+		In:          "query",
+		Description: fmt.Sprintf("Maximum number of values to return (default=%d)", bdog.MaxPerPage),
+		Schema:      APISchemaType{Type: "integer", Default: bdog.MaxPerPage, Minimum: 1, Maximum: bdog.MaxPerPage},
+	}, filterParameter)
+	if tab.IsSearchable() {
+		apiDistinct.Parameters = append(apiDistinct.Parameters, searchParameter)
+	}
+
+	distinctValues := func(column string, opts map[string][]string) ([]interface{}, error) {
+		opts["_group"] = []string{column}
+		opts["_aggregate"] = []string{"count:*"}
+		if _, ok := opts["_perpage"]; !ok {
+			opts["_perpage"] = []string{fmt.Sprint(bdog.MaxPerPage)}
+		}
+		data, err := agg.Aggregate(tab, opts)
+		if err != nil {
+			return nil, err
+		}
+		// use fixed names, in case the column is named "count"
+		countName := "count"
+		if column == countName {
+			countName = bdog.AggregateAlias(countName)
+		}
+		for i, row := range data {
+			row := row.(map[string]interface{})
+			data[i] = map[string]interface{}{"value": row[column], "count": row[countName]}
+		}
+		return data, nil
+	}
+
+	example, err := distinctValues(columns[0], make(map[string][]string))
+	if err == nil {
+		apiDistinct.AddExampleResponse(apiDistinct.Summary, example)
+	}
+
+	c.metaRouter.GET(route, func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		if c.CORSEnabled {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		column := params.ByName("column")
+		if _, ok := allowed[column]; !ok {
+			detailedError(w, http.StatusBadRequest,
+				fmt.Errorf("distinct values are only available for: %s", strings.Join(columns, ", ")))
+			return
+		}
+
+		opts := make(map[string][]string)
+		uq := r.URL.Query()
+		uq.Del("_page")
+		listingOptions(tab, uq, opts)
+
+		data, err := distinctValues(column, opts)
+		if err != nil {
+			log.Println(err)
+			if errors.Is(err, bdog.ErrInvalidFilter) {
+				detailedError(w, http.StatusBadRequest, err)
+				return
+			}
+			basicError(w, http.StatusInternalServerError)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(data)
+		if err != nil {
+			log.Println(err)
+			basicError(w, http.StatusInternalServerError)
+			return
+		}
+	})
+}
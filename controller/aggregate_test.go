@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAggregateGroupColumns(t *testing.T) {
+	schema := `CREATE TABLE widgets (id INTEGER PRIMARY KEY, name TEXT, color TEXT);
+		INSERT INTO widgets (name, color) VALUES ('a', 'red'), ('b', 'red'), ('c', 'blue'),
+			('d', 'red'), ('e', 'blue'), ('f', 'red'), ('g', 'blue'), ('h', 'red'), ('i', 'red');`
+	for _, tc := range []struct {
+		path        string
+		distinctAll bool
+		want        int
+	}{
+		{"/widgets/_aggregate?count=*", false, http.StatusOK},
+		{"/widgets/_aggregate?group=color&count=*", false, http.StatusOK},
+		{"/widgets/_aggregate?group=name&count=*", false, http.StatusBadRequest},
+		{"/widgets/_aggregate?group=color,id", false, http.StatusBadRequest},
+		{"/widgets/_aggregate?group=nope", false, http.StatusBadRequest},
+		{"/widgets/_distinct/name", false, http.StatusBadRequest},
+		{"/widgets/_aggregate?group=name&count=*", true, http.StatusOK},
+		{"/widgets/_distinct/name", true, http.StatusOK},
+	} {
+		c := sqliteController(t, schema)
+		c.DistinctAllColumns = tc.distinctAll
+		rec := httptest.NewRecorder()
+		c.GenerateRoutes("").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if rec.Code != tc.want {
+			t.Errorf("%s (all=%v): status = %d, want %d: %s", tc.path, tc.distinctAll, rec.Code, tc.want, rec.Body.String())
+		}
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/pbnjay/bdog"
+	"github.com/pbnjay/bdog/analyzer"
 )
 
 type Controller struct {
@@ -20,10 +22,46 @@ type Controller struct {
 	CORSEnabled  bool
 	OpenAPIRoute string
 
+	// Cardinality is used to find searchable columns in tables without a
+	// full-text index. If nil, only full-text indexes are searchable.
+	Cardinality *analyzer.Cardinality
+
+	// DistinctAllColumns allows "_distinct" values to be listed, and
+	// "_aggregate" results grouped, for any column. By default only columns
+	// that the Cardinality analysis classifies as ClassValues are allowed, so
+	// that e.g. keys can't be dumped.
+	DistinctAllColumns bool
+
+	// ExportMaxPerPage is the largest "_perpage" allowed for exported formats
+	// (e.g. CSV). If it is less than bdog.MaxPerPage, bdog.MaxPerPage is used.
+	ExportMaxPerPage int
+
+	// ExportAll allows all results to be exported at once using "_perpage=all"
+	// with streamed formats (e.g. NDJSON and CSV). It should only be enabled
+	// if all callers are trusted, e.g. using token authorization.
+	ExportAll bool
+
+	// ShowJunctionTables creates routes for junction tables (see
+	// bdog.LinkJunctions). By default they are hidden, and only used to list,
+	// link and unlink the items of the tables they connect.
+	ShowJunctionTables bool
+
+	// MaxIncludeDepth is the maximum number of tables in an "include" path,
+	// e.g. "region.country" has 2.
+	MaxIncludeDepth int
+
+	// MaxTreeDepth is the maximum number of levels returned by the
+	// "_ancestors" and "_descendants" endpoints (default bdog.DefaultTreeDepth).
+	MaxTreeDepth int
+
 	mod     bdog.Model
 	router  *httprouter.Router
 	apiSpec *OpenAPI
 
+	// metaRouter handles routes with reserved names (e.g. /airports/_aggregate)
+	// which would conflict with key parameters (e.g. /airports/:ident) in router.
+	metaRouter *httprouter.Router
+
 	tokenKey   []byte
 	newToken   func(string) string
 	checkToken func(string) (bool, string)
@@ -40,15 +78,61 @@ func New(name, version string, mod bdog.Model) (*Controller, error) {
 		ReadOnly:     false,
 		OpenAPIRoute: "/openapi.json",
 
+		MaxIncludeDepth: 2,
+		MaxTreeDepth:    bdog.DefaultTreeDepth,
+
 		mod: mod,
 	}, nil
 }
 
+// prepareListing adjusts the listing options in opts for the output format.
+func (c *Controller) prepareListing(tab bdog.Table, format listingFormat, opts map[string][]string) error {
+	if format.prepare != nil {
+		format.prepare(tab, opts)
+	}
+	if format.export && c.ExportMaxPerPage > bdog.MaxPerPage {
+		opts["_maxperpage"] = []string{strconv.Itoa(c.ExportMaxPerPage)}
+	}
+	if ppg := opts["_perpage"]; len(ppg) > 0 && ppg[0] == "all" {
+		if !c.ExportAll {
+			return errors.New("_perpage=all is not enabled")
+		}
+		if !format.stream {
+			return errors.New("_perpage=all is only available for streamed formats (ndjson, csv, tsv)")
+		}
+		delete(opts, "_page")
+		delete(opts, "_cursor")
+		opts["_unlimited"] = nil
+	}
+	return nil
+}
+
+// getTable returns the named table, with any SearchColumns needed to search
+// it without a full-text index. These are the text columns with mostly (or
+// entirely) unique values, e.g. names and codes but not categories.
+func (c *Controller) getTable(table string) bdog.Table {
+	tab := c.mod.GetTable(table)
+	if tab.FullTextIndex != "" || c.Cardinality == nil {
+		return tab
+	}
+	for _, col := range tab.Columns {
+		if tab.ColumnInfo[col].Type != bdog.TextType {
+			continue
+		}
+		cs, ok := c.Cardinality.ColumnStats(tab.Name, col)
+		if ok && (cs.UniqueClass == analyzer.MostlyUniqueValues || cs.UniqueClass == analyzer.KeyValues) {
+			tab.SearchColumns = append(tab.SearchColumns, col)
+		}
+	}
+	return tab
+}
+
 func (c *Controller) GenerateRoutes(extBaseURL string) http.Handler {
 	c.BaseURL = extBaseURL
 	c.apiSpec = NewOpenAPISpec(c.Name, c.Version, c.BaseURL)
 
 	c.router = httprouter.New()
+	c.metaRouter = httprouter.New()
 	if c.CORSEnabled {
 		c.router.GlobalOPTIONS = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if r.Header.Get("Access-Control-Request-Method") != "" {
@@ -83,23 +167,21 @@ func (c *Controller) GenerateRoutes(extBaseURL string) http.Handler {
 	}
 
 	for _, topLevel := range c.mod.ListTableNames() {
+		if c.isHidden(topLevel) {
+			continue
+		}
 		c.Single(topLevel)
 		c.Listing(topLevel)
+		c.Aggregate(topLevel)
+		c.Distinct(topLevel)
+		c.Tree(topLevel)
 
-		rels := c.mod.ListRelatedTableNames(topLevel)
-		if len(rels) > 0 {
-			for _, other := range rels {
-				otherTab := c.mod.GetTable(other)
-				colmaps := c.mod.GetRelatedTableMappings(topLevel, other)
-
-				for _, rights := range colmaps {
-					for _, right := range rights {
-						// if <right> is not the PK for <other> then this is a to-many relationshop
-						if !otherTab.Key.IsEqual(right) {
-							c.ListingFromSingle(topLevel, other)
-						}
-					}
-				}
+		for _, rel := range c.childRelations(topLevel) {
+			c.ListingFromRelation(topLevel, rel)
+		}
+		if !c.ReadOnly {
+			for _, rel := range c.manyToMany(topLevel) {
+				c.Link(topLevel, rel)
 			}
 		}
 
@@ -114,7 +196,7 @@ func (c *Controller) GenerateRoutes(extBaseURL string) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if r.Method == http.MethodPost && r.URL.Path == "/auth" {
 				// auth not required here
-				c.router.ServeHTTP(w, r)
+				c.serveHTTP(w, r)
 				return
 			}
 
@@ -129,8 +211,71 @@ func (c *Controller) GenerateRoutes(extBaseURL string) http.Handler {
 			} else {
 				log.Println(ident, r.Method, r.URL.Path)
 			}
-			c.router.ServeHTTP(w, r)
+			c.serveHTTP(w, r)
 		})
 	}
-	return c.router
+	return http.HandlerFunc(c.serveHTTP)
+}
+
+// isHidden returns true if the table should not have its own routes.
+func (c *Controller) isHidden(table string) bool {
+	return c.mod.GetTable(table).IsJunction && !c.ShowJunctionTables
+}
+
+// manyToMany returns the relations of the table to tables linked through
+// junction tables, excluding any linked to it directly.
+func (c *Controller) manyToMany(table string) []bdog.Relation {
+	direct := make(map[string]bool)
+	for _, other := range c.mod.ListRelatedTableNames(table) {
+		direct[other] = true
+	}
+	var res []bdog.Relation
+	tab := c.mod.GetTable(table)
+	for _, rel := range tab.ManyToManyRelations() {
+		if !direct[rel.Table] {
+			res = append(res, rel)
+		}
+	}
+	return res
+}
+
+// childRelations returns the to-many relations of the table which are not to
+// hidden tables, followed by the relations to tables linked through junction
+// tables.
+func (c *Controller) childRelations(table string) []bdog.Relation {
+	var res []bdog.Relation
+	tab := c.mod.GetTable(table)
+	for _, rel := range tab.ChildRelations(c.mod.GetTable) {
+		if !c.isHidden(rel.Table) {
+			res = append(res, rel)
+		}
+	}
+	return append(res, c.manyToMany(table)...)
+}
+
+// subqueryMapping adds a "_where" condition to opts to list the rows of tab2
+// linked to the row of tab1 with the key values by the relation. Relations
+// through a junction table only use that junction table, even if others link
+// the same tables.
+func (c *Controller) subqueryMapping(tab1, tab2 bdog.Table, rel bdog.Relation, key []string, opts map[string][]string) {
+	if rel.Junction != "" {
+		var links []bdog.JunctionLink
+		for _, link := range tab1.ManyToMany[rel.Table] {
+			if link.Junction == rel.Junction {
+				links = append(links, link)
+			}
+		}
+		tab1.ManyToMany = map[string][]bdog.JunctionLink{rel.Table: links}
+	}
+	c.mod.GetSubqueryMapping(tab1, tab2, rel.Columns, key, opts)
+}
+
+// serveHTTP dispatches a request to the metaRouter if it has a matching
+// route, and to the main router otherwise.
+func (c *Controller) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if h, params, _ := c.metaRouter.Lookup(r.Method, r.URL.Path); h != nil {
+		h(w, r, params)
+		return
+	}
+	c.router.ServeHTTP(w, r)
 }
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pbnjay/bdog"
+)
+
+// embeds returns a map from the "embed" names for the table (the names of its
+// to-many relations, including through junction tables, or the table names
+// for relations named after the table) to the relations, and the sorted list
+// of relation names.
+func (c *Controller) embeds(table string) (map[string]bdog.Relation, []string) {
+	embedMap := make(map[string]bdog.Relation)
+	var names []string
+	for _, rel := range c.childRelations(table) {
+		names = append(names, rel.Name)
+		embedMap[rel.Name] = rel
+	}
+	for _, rel := range embedMap {
+		childTab := c.mod.GetTable(rel.Table)
+		if _, dup := embedMap[rel.Table]; !dup && rel.Name == childTab.PluralName(false) {
+			embedMap[rel.Table] = rel
+		}
+	}
+	sort.Strings(names)
+	return embedMap, names
+}
+
+// embedParameters describes the "embed" and "embed_limit" options.
+func embedParameters(names []string) []APIParameter {
+	noExplode := false
+	return []APIParameter{{
+		Name: "embed",
+		In:   "query",
+		Description: "embed lists of linked records in the result. each list can be filtered and sorted using " +
+			"listing parameters prefixed with its name, e.g. `" + names[0] + "._sortby` or `" + names[0] + ".<field>[op]`. " +
+			"available options: " + strings.Join(names, ", "),
+		Schema: APISchemaType{
+			Type:  "array",
+			Items: &APISchemaType{Type: "string", Enum: names},
+		},
+		Style:   "form",
+		Explode: &noExplode,
+	}, {
+		Name:        "embed_limit",
+		In:          "query",
+		Description: fmt.Sprintf("Maximum number of records in each embedded list (default=%d)", bdog.DefaultPerPage),
+		Schema:      APISchemaType{Type: "integer", Default: bdog.DefaultPerPage, Minimum: 1, Maximum: bdog.MaxPerPage},
+	}}
+}
+
+// embedOptions returns the listing options for each relation embedded using
+// the "embed" names in the URL query. Names can be repeated or
+// comma-separated, and listing parameters prefixed with "<name>." apply to
+// that relation. Embedded lists are not paginated, but are limited using
+// "embed_limit".
+func (c *Controller) embedOptions(uq url.Values, embedMap map[string]bdog.Relation, names []string) (map[string]map[string][]string, error) {
+	limit := uq.Get("embed_limit")
+	if limit != "" {
+		if n, err := strconv.Atoi(limit); err != nil || n < 1 || n > bdog.MaxPerPage {
+			return nil, fmt.Errorf("invalid embed_limit '%s' (must be between 1 and %d)", limit, bdog.MaxPerPage)
+		}
+	}
+
+	res := make(map[string]map[string][]string)
+	for _, emb := range uq["embed"] {
+		for _, embName := range strings.Split(emb, ",") {
+			rel, validEmbed := embedMap[embName]
+			if !validEmbed {
+				return nil, fmt.Errorf("invalid embed '%s' (available: %s)", embName, strings.Join(names, ", "))
+			}
+			if _, dup := res[rel.Name]; dup {
+				continue
+			}
+
+			// parameters can use any name for the relation as a prefix
+			childTab := c.getTable(rel.Table)
+			sub := make(url.Values)
+			for varName, vals := range uq {
+				i := strings.IndexByte(varName, '.')
+				if i == -1 {
+					continue
+				}
+				if prel, ok := embedMap[varName[:i]]; ok && prel.Name == rel.Name {
+					sub[varName[i+1:]] = vals
+				}
+			}
+			sub.Del("_page")
+			sub.Del("_cursor")
+			sub.Del("_perpage")
+
+			opts := make(map[string][]string)
+			listingOptions(childTab, sub, opts)
+			if limit != "" {
+				opts["_perpage"] = []string{limit}
+			}
+			res[rel.Name] = opts
+		}
+	}
+	return res, nil
+}
+
+// embedLinked adds the lists of linked records for each embedded relation to
+// data (the row of tab with the key values), using the relation name.
+func (c *Controller) embedLinked(data map[string]interface{}, tab bdog.Table, key []string, embedMap map[string]bdog.Relation, embedOpts map[string]map[string][]string) error {
+	for name, opts := range embedOpts {
+		rel := embedMap[name]
+		childTab := c.getTable(rel.Table)
+		c.subqueryMapping(tab, childTab, rel, key, opts)
+		rows, err := childTab.Driver.Listing(childTab, opts)
+		if err != nil {
+			return err
+		}
+		data[name] = rows
+	}
+	return nil
+}
@@ -5,3 +5,9 @@ import "net/http"
 func basicError(w http.ResponseWriter, errCode int) {
 	http.Error(w, http.StatusText(errCode), errCode)
 }
+
+// detailedError includes the error message in the response body, so it
+// should only be used for errors that describe a problem with the request.
+func detailedError(w http.ResponseWriter, errCode int, err error) {
+	http.Error(w, http.StatusText(errCode)+": "+err.Error(), errCode)
+}
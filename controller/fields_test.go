@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFields(t *testing.T) {
+	h := compositeKeysHandler(t)
+	for _, tc := range []struct {
+		path string
+		code int
+		want []string
+	}{
+		{"/courses?_fields=title", http.StatusOK, []string{"dept", "number", "title"}},
+		{"/courses?_fields=number,title", http.StatusOK, []string{"dept", "number", "title"}},
+		{"/courses?_fields=nope", http.StatusBadRequest, nil},
+		{"/courses/CS/101?_fields=title", http.StatusOK, []string{"dept", "number", "title"}},
+		{"/courses/CS/101?_fields=dept", http.StatusOK, []string{"dept", "number"}},
+		{"/courses/CS/101?_fields=title,nope", http.StatusBadRequest, nil},
+		{"/departments/Mathematics?_fields=code", http.StatusOK, []string{"code"}},
+		{"/courses/CS/101/sections?_fields=instructor", http.StatusOK, []string{"course_number", "dept", "instructor", "section", "term"}},
+		{"/courses/CS/101/sections?_fields=nope", http.StatusBadRequest, nil},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if rec.Code != tc.code {
+			t.Errorf("%s: status = %d, want %d: %s", tc.path, rec.Code, tc.code, rec.Body.String())
+			continue
+		}
+		if tc.want == nil {
+			continue
+		}
+		var rows []map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &rows); err != nil {
+			// single rows are returned as an object
+			var row map[string]interface{}
+			if err = json.Unmarshal(rec.Body.Bytes(), &row); err != nil {
+				t.Fatal(err)
+			}
+			rows = append(rows, row)
+		}
+		if len(rows) == 0 {
+			t.Errorf("%s: no results", tc.path)
+		}
+		for _, row := range rows {
+			var got []string
+			for k := range row {
+				got = append(got, k)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("%s: got fields %v, want %v", tc.path, got, tc.want)
+			}
+		}
+	}
+}
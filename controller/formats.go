@@ -0,0 +1,313 @@
+package controller
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pbnjay/bdog"
+)
+
+// listingWriter encodes listing results one row at a time.
+type listingWriter interface {
+	WriteRow(row map[string]interface{}) error
+	// Close finishes the output, e.g. closing a JSON array.
+	Close() error
+}
+
+// listingFormat is an output format for listing results.
+type listingFormat struct {
+	mediaType string
+
+	// available returns true if the format can be used for the table,
+	// or is nil if it can always be used.
+	available func(tab bdog.Table) bool
+
+	// prepare adjusts the listing options before the query, e.g. to make
+	// sure the fields needed by the format are returned. It may be nil.
+	prepare func(tab bdog.Table, opts map[string][]string)
+
+	// newWriter starts encoding listing results to w.
+	newWriter func(w io.Writer, tab bdog.Table, opts map[string][]string) (listingWriter, error)
+
+	// stream formats are written as rows are read (if the Driver is a
+	// bdog.Iterator), so can export all results at once (see Controller.ExportAll).
+	stream bool
+
+	// export formats are downloaded as a file, and may use larger pages
+	// (see Controller.ExportMaxPerPage).
+	export    bool
+	extension string
+}
+
+var listingFormats = map[string]listingFormat{
+	"json": {
+		mediaType: "application/json",
+		newWriter: func(w io.Writer, tab bdog.Table, opts map[string][]string) (listingWriter, error) {
+			return &jsonArrayWriter{w: w}, nil
+		},
+	},
+	"ndjson": {
+		mediaType: "application/x-ndjson",
+		newWriter: func(w io.Writer, tab bdog.Table, opts map[string][]string) (listingWriter, error) {
+			return ndjsonWriter{json.NewEncoder(w)}, nil
+		},
+		stream: true,
+	},
+	"csv": {
+		mediaType: "text/csv",
+		newWriter: delimitedWriter(','),
+		stream:    true,
+		export:    true,
+		extension: ".csv",
+	},
+	"tsv": {
+		mediaType: "text/tab-separated-values",
+		newWriter: delimitedWriter('\t'),
+		stream:    true,
+		export:    true,
+		extension: ".tsv",
+	},
+	"geojson": {
+		mediaType: "application/geo+json",
+		available: func(tab bdog.Table) bool {
+			_, _, ok := tab.GeoColumns()
+			return ok
+		},
+		prepare: func(tab bdog.Table, opts map[string][]string) {
+			if _, ok := opts["_fields"]; ok {
+				lat, lon, _ := tab.GeoColumns()
+				opts["_fields"] = append(opts["_fields"], lat, lon)
+			}
+		},
+		newWriter: newGeoJSONWriter,
+	},
+}
+
+// availableFormats returns the sorted names of the formats available for the table.
+func availableFormats(tab bdog.Table) []string {
+	var res []string
+	for name, f := range listingFormats {
+		if f.available == nil || f.available(tab) {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// formatParameterName is the query parameter used to choose the output
+// format. It is "format" unless the table has a column of that name.
+func formatParameterName(tab bdog.Table) string {
+	if tab.HasColumn("format") {
+		return "_format"
+	}
+	return "format"
+}
+
+// formatParameter describes the output format option.
+func formatParameter(tab bdog.Table) APIParameter {
+	formats := availableFormats(tab)
+	return APIParameter{
+		Name: formatParameterName(tab),
+		In:   "query",
+		Description: "Output format for the results (default=json). " +
+			"The format can also be chosen using the Accept header.",
+		Schema: APISchemaType{Type: "string", Default: "json", Enum: formats},
+	}
+}
+
+// requestFormat returns the listing format requested using the format query
+// parameter (or "_format") or the Accept header, defaulting to JSON.
+func requestFormat(tab bdog.Table, r *http.Request) (listingFormat, error) {
+	uq := r.URL.Query()
+	name := uq.Get("_format")
+	if name == "" && !tab.HasColumn("format") {
+		name = uq.Get("format")
+	}
+	if name != "" {
+		f, ok := listingFormats[strings.ToLower(name)]
+		if !ok || (f.available != nil && !f.available(tab)) {
+			return f, fmt.Errorf("format '%s' is not available (available: %s)",
+				name, strings.Join(availableFormats(tab), ", "))
+		}
+		return f, nil
+	}
+
+	// the first acceptable media type we know is used
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		for _, f := range listingFormats {
+			if f.mediaType == mt && (f.available == nil || f.available(tab)) {
+				return f, nil
+			}
+		}
+	}
+	return listingFormats["json"], nil
+}
+
+// jsonArrayWriter writes the results as a JSON array, followed by suffix.
+type jsonArrayWriter struct {
+	w      io.Writer
+	n      int
+	suffix string
+}
+
+func (j *jsonArrayWriter) writeValue(v interface{}) error {
+	sep := ","
+	if j.n == 0 {
+		sep = "["
+	}
+	j.n++
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(j.w, sep+string(b))
+	return err
+}
+
+func (j *jsonArrayWriter) WriteRow(row map[string]interface{}) error {
+	return j.writeValue(row)
+}
+
+func (j *jsonArrayWriter) Close() error {
+	end := "]" + j.suffix + "\n"
+	if j.n == 0 {
+		end = "[" + end
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+// ndjsonWriter writes each result as a JSON object on its own line.
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (n ndjsonWriter) WriteRow(row map[string]interface{}) error {
+	return n.enc.Encode(row)
+}
+
+func (n ndjsonWriter) Close() error {
+	return nil
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	ID         interface{}            `json:"id,omitempty"`
+	Geometry   *geoJSONGeometry       `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string        `json:"type"`
+	Coordinates []interface{} `json:"coordinates"`
+}
+
+// geoJSONWriter writes the results as a FeatureCollection of Points, with
+// the other fields as properties. Rows without coordinates have a null
+// geometry.
+type geoJSONWriter struct {
+	features *jsonArrayWriter
+	tab      bdog.Table
+	lat, lon string
+}
+
+func newGeoJSONWriter(w io.Writer, tab bdog.Table, opts map[string][]string) (listingWriter, error) {
+	lat, lon, _ := tab.GeoColumns()
+	_, err := io.WriteString(w, `{"type":"FeatureCollection","features":`)
+	return &geoJSONWriter{features: &jsonArrayWriter{w: w, suffix: "}"}, tab: tab, lat: lat, lon: lon}, err
+}
+
+func (g *geoJSONWriter) WriteRow(row map[string]interface{}) error {
+	feat := geoJSONFeature{
+		Type:       "Feature",
+		Properties: make(map[string]interface{}, len(row)),
+	}
+	if len(g.tab.Key) == 1 {
+		feat.ID = row[g.tab.Key[0]]
+	}
+	if row[g.lat] != nil && row[g.lon] != nil {
+		feat.Geometry = &geoJSONGeometry{
+			Type:        "Point",
+			Coordinates: []interface{}{row[g.lon], row[g.lat]},
+		}
+	}
+	for k, v := range row {
+		if k != g.lat && k != g.lon {
+			feat.Properties[k] = v
+		}
+	}
+	return g.features.writeValue(feat)
+}
+
+func (g *geoJSONWriter) Close() error {
+	return g.features.Close()
+}
+
+// delimitedWriter returns a listingWriter constructor for CSV-style output
+// using the delimiter. The header row lists the requested fields.
+func delimitedWriter(delim rune) func(w io.Writer, tab bdog.Table, opts map[string][]string) (listingWriter, error) {
+	return func(w io.Writer, tab bdog.Table, opts map[string][]string) (listingWriter, error) {
+		fields, err := tab.FieldList(opts)
+		if err != nil {
+			return nil, err
+		}
+		cw := csv.NewWriter(w)
+		cw.Comma = delim
+		if err = cw.Write(fields); err != nil {
+			return nil, err
+		}
+		return &csvWriter{cw: cw, fields: fields, record: make([]string, len(fields))}, nil
+	}
+}
+
+type csvWriter struct {
+	cw     *csv.Writer
+	fields []string
+	record []string
+}
+
+func (c *csvWriter) WriteRow(row map[string]interface{}) error {
+	for i, cn := range c.fields {
+		c.record[i] = delimitedValue(row[cn])
+	}
+	if err := c.cw.Write(c.record); err != nil {
+		return err
+	}
+	// rows are buffered by the http.ResponseWriter instead
+	c.cw.Flush()
+	return c.cw.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.cw.Flush()
+	return c.cw.Error()
+}
+
+// delimitedValue formats a JSON-ready value for CSV output.
+func delimitedValue(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case []byte:
+		// matches the JSON encoding of binary data
+		return base64.StdEncoding.EncodeToString(x)
+	}
+	return fmt.Sprint(v)
+}
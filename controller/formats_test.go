@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const airportsSchema = `CREATE TABLE airports (ident TEXT PRIMARY KEY, name TEXT, latitude_deg REAL, longitude_deg REAL);
+	INSERT INTO airports VALUES ('KCLT', 'Charlotte', 35.21, -80.94), ('KRDU', 'Raleigh-Durham', 35.88, -78.79),
+		('X1', 'Unknown', NULL, NULL);`
+
+func TestGeoJSON(t *testing.T) {
+	h := sqliteHandler(t, airportsSchema+`CREATE TABLE runways (id INTEGER PRIMARY KEY, airport_ident TEXT);`)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/airports?format=geojson&_fields=name", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/geo+json" {
+		t.Errorf("Content-Type = %s", ct)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"type": "FeatureCollection",
+		"features": []interface{}{
+			map[string]interface{}{"type": "Feature", "id": "KCLT",
+				"geometry":   map[string]interface{}{"type": "Point", "coordinates": []interface{}{-80.94, 35.21}},
+				"properties": map[string]interface{}{"ident": "KCLT", "name": "Charlotte"}},
+			map[string]interface{}{"type": "Feature", "id": "KRDU",
+				"geometry":   map[string]interface{}{"type": "Point", "coordinates": []interface{}{-78.79, 35.88}},
+				"properties": map[string]interface{}{"ident": "KRDU", "name": "Raleigh-Durham"}},
+			map[string]interface{}{"type": "Feature", "id": "X1", "geometry": nil,
+				"properties": map[string]interface{}{"ident": "X1", "name": "Unknown"}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// the Accept header selects GeoJSON too
+	req := httptest.NewRequest(http.MethodGet, "/airports?ident=X2", nil)
+	req.Header.Set("Accept", "application/geo+json")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if body := rec.Body.String(); rec.Code != http.StatusOK || body != `{"type":"FeatureCollection","features":[]}`+"\n" {
+		t.Errorf("empty results: status = %d: %s", rec.Code, body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/runways?format=geojson", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("table without coordinates: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestDelimitedFormats(t *testing.T) {
+	h := sqliteHandler(t, airportsSchema)
+	for _, tc := range []struct {
+		path, accept string
+		mediaType    string
+		filename     string
+		body         string
+	}{
+		{"/airports?format=csv", "", "text/csv", "airports.csv",
+			"ident,name,latitude_deg,longitude_deg\nKCLT,Charlotte,35.21,-80.94\nKRDU,Raleigh-Durham,35.88,-78.79\nX1,Unknown,,\n"},
+		{"/airports?format=csv&_fields=name&_sortby=-name", "", "text/csv", "airports.csv",
+			"ident,name\nX1,Unknown\nKRDU,Raleigh-Durham\nKCLT,Charlotte\n"},
+		{"/airports?_fields=latitude_deg,name&name[like]=%25-%25", "text/tab-separated-values", "text/tab-separated-values", "airports.tsv",
+			"ident\tlatitude_deg\tname\nKRDU\t35.88\tRaleigh-Durham\n"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.accept != "" {
+			req.Header.Set("Accept", tc.accept)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status = %d: %s", tc.path, rec.Code, rec.Body.String())
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != tc.mediaType {
+			t.Errorf("%s: Content-Type = %s, want %s", tc.path, ct, tc.mediaType)
+		}
+		if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, `filename="`+tc.filename+`"`) {
+			t.Errorf("%s: Content-Disposition = %s, want %s", tc.path, cd, tc.filename)
+		}
+		if body := rec.Body.String(); body != tc.body {
+			t.Errorf("%s = %q, want %q", tc.path, body, tc.body)
+		}
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	schema := `CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT);
+		WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i+1 FROM n WHERE i < 600)
+		INSERT INTO items SELECT i, 'item ' || i FROM n;`
+	for _, tc := range []struct {
+		query     string
+		exportAll bool
+		code      int
+		rows      int
+	}{
+		{"format=ndjson", false, http.StatusOK, 10},
+		{"format=ndjson&_perpage=500&id[gt]=550", false, http.StatusOK, 50},
+		{"format=ndjson&_perpage=all", false, http.StatusBadRequest, 0},
+		{"format=csv&_perpage=all", false, http.StatusBadRequest, 0},
+		{"format=ndjson&_perpage=all", true, http.StatusOK, 600},
+		{"format=ndjson&_perpage=all&id[lte]=5", true, http.StatusOK, 5},
+		{"format=json&_perpage=all", true, http.StatusBadRequest, 0},
+	} {
+		c := sqliteController(t, schema)
+		c.ExportAll = tc.exportAll
+		rec := httptest.NewRecorder()
+		c.GenerateRoutes("").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items?"+tc.query, nil))
+		if rec.Code != tc.code {
+			t.Errorf("%s (all=%v): status = %d, want %d: %s", tc.query, tc.exportAll, rec.Code, tc.code, rec.Body.String())
+			continue
+		}
+		if tc.code != http.StatusOK {
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("%s: Content-Type = %s", tc.query, ct)
+		}
+		// all rows are streamed without pagination
+		if link := rec.Header().Get("Link"); (link == "") != tc.exportAll {
+			t.Errorf("%s (all=%v): Link = %s", tc.query, tc.exportAll, link)
+		}
+		lines := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+		if len(lines) != tc.rows {
+			t.Errorf("%s (all=%v): got %d lines, want %d", tc.query, tc.exportAll, len(lines), tc.rows)
+			continue
+		}
+		for i, line := range lines {
+			var row map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &row); err != nil {
+				t.Errorf("%s line %d: %v", tc.query, i+1, err)
+				break
+			}
+			if id, _ := row["id"].(float64); int(id) < 1 || row["name"] == nil {
+				t.Errorf("%s line %d = %s", tc.query, i+1, line)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIncludePaths(t *testing.T) {
+	schema := `CREATE TABLE continents (code TEXT PRIMARY KEY, name TEXT);
+		CREATE TABLE countries (code TEXT PRIMARY KEY, name TEXT, continent_code TEXT REFERENCES continents(code));
+		CREATE TABLE regions (id INTEGER PRIMARY KEY, name TEXT, country_code TEXT REFERENCES countries(code));
+		CREATE TABLE airports (ident TEXT PRIMARY KEY, region_id INTEGER REFERENCES regions(id));
+		INSERT INTO continents VALUES ('NA', 'North America');
+		INSERT INTO countries VALUES ('US', 'United States', 'NA'), ('CA', 'Canada', 'NA');
+		INSERT INTO regions VALUES (1, 'North Carolina', 'US'), (2, 'Ontario', 'CA');
+		INSERT INTO airports VALUES ('KCLT', 1), ('CYYZ', 2), ('KRDU', 1);`
+	for _, tc := range []struct {
+		path     string
+		maxDepth int
+		code     int
+		country  string
+	}{
+		{"/airports?include=region.country", 2, http.StatusOK, "Canada"},
+		{"/airports?include=region,region.country", 2, http.StatusOK, "Canada"},
+		{"/airports/KCLT?include=region.country", 2, http.StatusOK, "United States"},
+		{"/airports?include=region.country.continent", 2, http.StatusBadRequest, ""},
+		{"/airports/KCLT?include=region.country.continent", 2, http.StatusBadRequest, ""},
+		{"/airports?include=region.country.continent", 3, http.StatusOK, "Canada"},
+		{"/airports?include=region.country", 1, http.StatusBadRequest, ""},
+		{"/regions?include=airports", 2, http.StatusBadRequest, ""},
+		{"/airports?include=region.airports", 2, http.StatusBadRequest, ""},
+		{"/regions/1?include=country.regions", 2, http.StatusBadRequest, ""},
+	} {
+		c := sqliteController(t, schema)
+		c.MaxIncludeDepth = tc.maxDepth
+		rec := httptest.NewRecorder()
+		c.GenerateRoutes("").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if rec.Code != tc.code {
+			t.Errorf("%s (depth %d): status = %d, want %d: %s", tc.path, tc.maxDepth, rec.Code, tc.code, rec.Body.String())
+			continue
+		}
+		if tc.code != http.StatusOK {
+			continue
+		}
+		// listings are sorted by ident, so start with CYYZ
+		var airport map[string]interface{}
+		var rows []map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &rows); err == nil {
+			airport = rows[0]
+		} else if err = json.Unmarshal(rec.Body.Bytes(), &airport); err != nil {
+			t.Fatal(err)
+		}
+		region, _ := airport["region"].(map[string]interface{})
+		country, _ := region["country"].(map[string]interface{})
+		if country["name"] != tc.country {
+			t.Errorf("%s: got %v, want country %s", tc.path, airport, tc.country)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package controller
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -32,17 +34,19 @@ func (c *Controller) Insert(table string) {
 		opts := make(map[string][]string)
 		if r.Header.Get("Content-Type") == "application/json" {
 			data := make(map[string]interface{})
-			err := json.NewDecoder(r.Body).Decode(&data)
+			dec := json.NewDecoder(r.Body)
+			// keep numbers in their original format, e.g. avoid 1e+06
+			dec.UseNumber()
+			err := dec.Decode(&data)
 			if err != nil {
 				log.Println(err)
 				basicError(w, http.StatusBadRequest)
 				return
 			}
-			for _, colname := range tab.Columns {
-				val, ok := data[colname]
-				if ok {
-					opts[colname] = append(opts[colname], fmt.Sprint(val))
-				}
+			if err = jsonOptions(tab, data, opts); err != nil {
+				log.Println(err)
+				detailedError(w, http.StatusBadRequest, err)
+				return
 			}
 		} else {
 			r.ParseForm()
@@ -61,6 +65,10 @@ func (c *Controller) Insert(table string) {
 				basicError(w, http.StatusNotFound)
 				return
 			}
+			if errors.Is(err, bdog.ErrInsertFailed) {
+				detailedError(w, http.StatusBadRequest, err)
+				return
+			}
 			basicError(w, http.StatusInternalServerError)
 			return
 		}
@@ -73,3 +81,31 @@ func (c *Controller) Insert(table string) {
 		}
 	})
 }
+
+// jsonOptions adds the values of the table's columns in a decoded JSON request
+// body to opts. A null value sets the column to NULL, and BlobType values are
+// base64-encoded as in responses, so a response can be sent back unchanged.
+// Booleans are converted for BooleanType columns by bdog.Table.ColumnArg.
+func jsonOptions(tab bdog.Table, data map[string]interface{}, opts map[string][]string) error {
+	for _, colname := range tab.Columns {
+		val, ok := data[colname]
+		if !ok {
+			continue
+		}
+		switch {
+		case val == nil:
+			opts[colname] = []string{""}
+			opts["_null"] = append(opts["_null"], colname)
+		case tab.ColumnInfo[colname].Type == bdog.BlobType:
+			s, isString := val.(string)
+			b, err := base64.StdEncoding.DecodeString(s)
+			if !isString || err != nil {
+				return fmt.Errorf("value for '%s' must be a base64-encoded string", colname)
+			}
+			opts[colname] = []string{string(b)}
+		default:
+			opts[colname] = []string{fmt.Sprint(val)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInsertBooleanFromJSON(t *testing.T) {
+	h := sqliteHandler(t, `CREATE TABLE widgets (id INTEGER PRIMARY KEY, name TEXT, active BOOLEAN);`)
+	for _, body := range []string{
+		`{"name": "on", "active": true}`,
+		`{"name": "off", "active": false}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/widgets", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("POST %s: status = %d: %s", body, rec.Code, rec.Body.String())
+		}
+	}
+
+	for _, tc := range []struct {
+		path string
+		want []string
+	}{
+		{"/widgets?active=true", []string{"on"}},
+		{"/widgets?active=false", []string{"off"}},
+		{"/widgets?active=1", []string{"on"}},
+		{"/widgets?active[ne]=true", []string{"off"}},
+		{"/widgets?active[in]=true,false", []string{"on", "off"}},
+		{"/widgets?_q=active%3Dtrue", []string{"on"}},
+		{"/widgets?_q=active+in+(false)", []string{"off"}},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", tc.path, rec.Code, rec.Body.String())
+		}
+		var rows []map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &rows); err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != len(tc.want) {
+			t.Fatalf("%s = %v, want names %v", tc.path, rows, tc.want)
+		}
+		for i, row := range rows {
+			if row["name"] != tc.want[i] {
+				t.Errorf("%s row %d = %v, want name %s", tc.path, i, row, tc.want[i])
+			}
+			if _, isBool := row["active"].(bool); !isBool {
+				t.Errorf("%s row %d active = %#v, want a boolean", tc.path, i, row["active"])
+			}
+		}
+	}
+}
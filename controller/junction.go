@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pbnjay/bdog"
+)
+
+// Link creates PUT and DELETE endpoints to add or remove a link between a
+// <table1> item and an item of the many-to-many relation rel, in its junction
+// table (e.g. PUT /students/1234/courses/567 to enroll a student in a course).
+func (c *Controller) Link(table1 string, rel bdog.Relation) {
+	tab1 := c.mod.GetTable(table1)
+	tab2 := c.mod.GetTable(rel.Table)
+	var link bdog.JunctionLink
+	for _, jl := range tab1.ManyToMany[rel.Table] {
+		if jl.Junction == rel.Junction {
+			link = jl
+			break
+		}
+	}
+	jtab := c.mod.GetTable(link.Junction)
+	drv := jtab.Driver
+
+	// table2 key parameters are renamed if they clash with table1's
+	params2 := make([]string, len(tab2.Key))
+	for i, colname := range tab2.Key {
+		params2[i] = colname
+		if tab1.Key.Contains(colname) {
+			params2[i] = tab2.SingleName(false) + "_" + colname
+		}
+	}
+	route := "/" + tab1.PluralName(false) + "/:" + strings.Join(tab1.Key, "/:") +
+		"/" + rel.Name + "/:" + strings.Join(params2, "/:")
+
+	// linkOptions returns the junction table key for the linked items,
+	// or an error if either item does not exist.
+	linkOptions := func(params httprouter.Params) (map[string][]string, error) {
+		opts1 := make(map[string][]string)
+		opts2 := make(map[string][]string)
+		opts := make(map[string][]string)
+		for i, colname := range tab1.Key {
+			opts1[colname] = []string{params.ByName(colname)}
+			opts[link.From[i]] = opts1[colname]
+		}
+		for i, colname := range tab2.Key {
+			opts2[colname] = []string{params.ByName(params2[i])}
+			opts[link.To[i]] = opts2[colname]
+		}
+		if _, err := tab1.Driver.Get(tab1, opts1); err != nil {
+			return nil, err
+		}
+		if _, err := tab2.Driver.Get(tab2, opts2); err != nil {
+			return nil, err
+		}
+		return opts, nil
+	}
+
+	log.Println("PUT", route)
+	apiPut := c.apiSpec.NewHandler("PUT", route)
+	apiPut.Summary = "Link a " + tab2.SingleName(true) + " to a given " + tab1.SingleName(true)
+	apiPut.Description = "Adds the link to " + jtab.PluralName(true) + " if it does not already exist. " +
+		"Other " + jtab.SingleName(true) + " fields can be given in the request body."
+
+	c.router.PUT(route, func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		if r.Method != http.MethodPut {
+			basicError(w, http.StatusMethodNotAllowed)
+			return
+		}
+		if c.CORSEnabled {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		opts, err := linkOptions(params)
+		if err != nil {
+			log.Println(err)
+			if err == bdog.ErrNotFound {
+				basicError(w, http.StatusNotFound)
+				return
+			}
+			basicError(w, http.StatusInternalServerError)
+			return
+		}
+
+		data, err := drv.Get(jtab, opts)
+		if err == bdog.ErrNotFound {
+			if r.Header.Get("Content-Type") == "application/json" {
+				body := make(map[string]interface{})
+				dec := json.NewDecoder(r.Body)
+				// keep numbers in their original format, e.g. avoid 1e+06
+				dec.UseNumber()
+				if err = dec.Decode(&body); err != nil {
+					log.Println(err)
+					basicError(w, http.StatusBadRequest)
+					return
+				}
+				for _, colname := range jtab.Key {
+					delete(body, colname)
+				}
+				if err = jsonOptions(jtab, body, opts); err != nil {
+					log.Println(err)
+					detailedError(w, http.StatusBadRequest, err)
+					return
+				}
+			} else {
+				r.ParseForm()
+				for _, colname := range jtab.Columns {
+					if vals, ok := r.Form[colname]; ok && len(vals) > 0 && !jtab.Key.Contains(colname) {
+						opts[colname] = vals
+					}
+				}
+			}
+			var res interface{}
+			res, err = drv.Insert(jtab, opts)
+			if err == nil {
+				w.WriteHeader(http.StatusCreated)
+				err = json.NewEncoder(w).Encode(res)
+			}
+		} else if err == nil {
+			err = json.NewEncoder(w).Encode(data)
+		}
+		if err != nil {
+			log.Println(err)
+			basicError(w, http.StatusInternalServerError)
+			return
+		}
+	})
+
+	log.Println("DELETE", route)
+	apiDelete := c.apiSpec.NewHandler("DELETE", route)
+	apiDelete.Summary = "Unlink a " + tab2.SingleName(true) + " from a given " + tab1.SingleName(true)
+
+	c.router.DELETE(route, func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		if r.Method != http.MethodDelete {
+			basicError(w, http.StatusMethodNotAllowed)
+			return
+		}
+		if c.CORSEnabled {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		opts := make(map[string][]string)
+		for i, colname := range tab1.Key {
+			opts[link.From[i]] = []string{params.ByName(colname)}
+		}
+		for i := range tab2.Key {
+			opts[link.To[i]] = []string{params.ByName(params2[i])}
+		}
+
+		_, err := drv.Get(jtab, opts)
+		if err == nil {
+			err = drv.Delete(jtab, opts)
+		}
+		if err != nil {
+			log.Println(err)
+			if err == bdog.ErrNotFound {
+				basicError(w, http.StatusNotFound)
+				return
+			}
+			basicError(w, http.StatusInternalServerError)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(map[string]string{"message": "link successfully deleted"})
+		if err != nil {
+			log.Println(err)
+			basicError(w, http.StatusInternalServerError)
+			return
+		}
+	})
+}
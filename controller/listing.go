@@ -1,46 +1,384 @@
 package controller
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/pbnjay/bdog"
 )
 
+var filterDescription = "Results can be filtered using `column=value` or `column[op]=value` query parameters, " +
+	"where op is one of: " + strings.Join(bdog.FilterOperators, ", ") + ". " +
+	"Multiple filters are combined using AND. " +
+	"More complex conditions can be given as a filter expression in the `_q` (or `filter`) parameter, " +
+	"e.g. `iso_country=US AND (type=large_airport OR scheduled_service=yes)`."
+
+var filterParameter = APIParameter{
+	Name:        "_q",
+	In:          "query",
+	Description: "Filter expression using AND, OR, NOT, parentheses and comparisons (e.g. `name like '%Intl%' OR elevation_ft >= 5000`)",
+	Schema:      APISchemaType{Type: "string"},
+}
+
+var searchParameter = APIParameter{
+	Name:        "_search",
+	In:          "query",
+	Description: "Search terms to find (all words must match). Results are ranked by relevance when a full-text index is available.",
+	Schema:      APISchemaType{Type: "string"},
+}
+
+// geoParameters describes the geospatial options, if the table has latitude and longitude fields.
+func geoParameters(tab bdog.Table) []APIParameter {
+	lat, lon, ok := tab.GeoColumns()
+	if !ok {
+		return nil
+	}
+	return []APIParameter{{
+		Name:        "_bbox",
+		In:          "query",
+		Description: fmt.Sprintf("Bounding box as minLon,minLat,maxLon,maxLat to find %s within (using %s and %s)", tab.PluralName(true), lon, lat),
+		Schema:      APISchemaType{Type: "string"},
+		Example:     "-80.0,35.0,-78.0,36.0",
+	}, {
+		Name:        "_near",
+		In:          "query",
+		Description: fmt.Sprintf("Point as lat,lon to order %s by distance from (unless _sortby is given)", tab.PluralName(true)),
+		Schema:      APISchemaType{Type: "string"},
+		Example:     "35.2,-80.9",
+	}, {
+		Name:        "_radius_km",
+		In:          "query",
+		Description: fmt.Sprintf("Distance in kilometers from the _near point to find %s within", tab.PluralName(true)),
+		Schema:      APISchemaType{Type: "number"},
+	}}
+}
+
+// paginationParameters describes the "_page", "_perpage" and "_count" options.
+func paginationParameters(tab bdog.Table) []APIParameter {
+	return []APIParameter{{
+		Name:        "_page",
+		In:          "query",
+		Description: "Page number to return (default=1). Links to the first, previous, next and last pages are given in the Link response header.",
+		Schema:      APISchemaType{Type: "integer", Default: 1, Minimum: 1},
+	}, {
+		Name:        "_perpage",
+		In:          "query",
+		Description: fmt.Sprintf("Number of %s per page to return (default=%d)", tab.PluralName(true), bdog.DefaultPerPage),
+		Schema:      APISchemaType{Type: "integer", Default: bdog.DefaultPerPage, Minimum: 1, Maximum: bdog.MaxPerPage},
+	}, {
+		Name: "_cursor",
+		In:   "query",
+		Description: "Opaque cursor from the X-Next-Cursor response header, used to fetch the next page of results instead of _page. Faster for large tables. " +
+			"Only available when sorting by fields without empty values, and without _nulls.",
+		Schema: APISchemaType{Type: "string"},
+	}, {
+		Name:        "_count",
+		In:          "query",
+		Description: "Count the total number of results, returned in the X-Total-Count response header",
+		Schema:      APISchemaType{Type: "boolean", Default: false},
+	}}
+}
+
+// paginationHeaders adds a RFC 8288 Link header to a listing response, with
+// links to the first, previous and next pages of results. If the "_count"
+// parameter was given and the Driver is a bdog.Counter, the total number of
+// results is returned in the X-Total-Count header and the last page is also
+// linked.
+//
+// When the page is full, a cursor for the next page is also returned in the
+// X-Next-Cursor header, unless the results are ordered by distance from a
+// "_near" point, by search relevance or by fields with NULL values (see
+// bdog.Table.IsSeekable), which a cursor cannot seek past. If
+// the request itself used a "_cursor", the next link uses the cursor and
+// there are no prev or last links.
+func paginationHeaders(w http.ResponseWriter, r *http.Request, tab bdog.Table, opts map[string][]string, data []interface{}) error {
+	page, perPage := bdog.Pagination(opts)
+	lastPage := 0
+	if cnt, ok := tab.Driver.(bdog.Counter); ok && isTrue(r.URL.Query().Get("_count")) {
+		total, err := cnt.Count(tab, opts)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		lastPage = (total + perPage - 1) / perPage
+		if lastPage < 1 {
+			lastPage = 1
+		}
+	}
+
+	nextCursor := ""
+	if len(data) > 0 && len(data) == perPage && tab.DistanceOrder(opts) == "" && !tab.IsRankedSearch(opts) {
+		if row, ok := data[len(data)-1].(map[string]interface{}); ok {
+			sortFields, err := tab.SortFields(opts)
+			if err != nil {
+				return err
+			}
+			if tab.IsSeekable(sortFields) {
+				nextCursor = bdog.NextCursor(sortFields, row)
+				w.Header().Set("X-Next-Cursor", nextCursor)
+			}
+		}
+	}
+
+	pageLink := func(pg int, rel string) string {
+		q := r.URL.Query()
+		q.Del("_cursor")
+		q.Set("_page", strconv.Itoa(pg))
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, q.Encode(), rel)
+	}
+	links := []string{pageLink(1, "first")}
+
+	if _, isCursor := opts["_cursor"]; isCursor {
+		if nextCursor != "" {
+			q := r.URL.Query()
+			q.Del("_page")
+			q.Set("_cursor", nextCursor)
+			links = append(links, fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, q.Encode()))
+		}
+		w.Header().Set("Link", strings.Join(links, ", "))
+		return nil
+	}
+
+	if page > 1 {
+		links = append(links, pageLink(page-1, "prev"))
+	}
+	// without a count, a full page probably means there are more results
+	if (lastPage == 0 && len(data) == perPage) || page < lastPage {
+		links = append(links, pageLink(page+1, "next"))
+	}
+	if lastPage > 0 {
+		links = append(links, pageLink(lastPage, "last"))
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+	return nil
+}
+
+// isTrue returns true for boolean-like query values, e.g. "1", "true", "yes".
+func isTrue(val string) bool {
+	switch strings.ToLower(val) {
+	case "1", "t", "true", "y", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// sortParameter describes the "_sortby" option, listing the valid fields to
+// sort by in ascending or (prefixed with -) descending order.
+func sortParameter(tab bdog.Table) APIParameter {
+	fields := make([]string, 0, 2*len(tab.Columns))
+	for _, cn := range tab.Columns {
+		fields = append(fields, cn, "-"+cn)
+	}
+	noExplode := false
+	return APIParameter{
+		Name: "_sortby",
+		In:   "query",
+		Description: "Comma-separated fields to sort the results by (default=" + strings.Join(tab.Key, ", ") + "). " +
+			"Prefix a field with - for descending order.",
+		Schema: APISchemaType{
+			Type:    "array",
+			Default: tab.Key,
+			Items:   &APISchemaType{Type: "string", Enum: fields},
+		},
+		Style:   "form",
+		Explode: &noExplode,
+	}
+}
+
+// nullsParameter describes the "_nulls" option.
+var nullsParameter = APIParameter{
+	Name:        "_nulls",
+	In:          "query",
+	Description: "Position of empty values in the _sortby fields (default depends on the database)",
+	Schema:      APISchemaType{Type: "string", Enum: []string{"first", "last"}},
+}
+
+// fieldsParameter describes the "_fields" option, listing the valid field names.
+func fieldsParameter(tab bdog.Table) APIParameter {
+	noExplode := false
+	return APIParameter{
+		Name: "_fields",
+		In:   "query",
+		Description: "Comma-separated fields to return (default=all). " +
+			"The key fields (" + strings.Join(tab.Key, ", ") + ") are always included.",
+		Schema: APISchemaType{
+			Type:  "array",
+			Items: &APISchemaType{Type: "string", Enum: tab.Columns},
+		},
+		Style:   "form",
+		Explode: &noExplode,
+	}
+}
+
+// listingOptionNames are the query parameters passed through as listing options.
+var listingOptionNames = map[string]struct{}{
+	"_page": {}, "_perpage": {}, "_sortby": {}, "_nulls": {}, "_cursor": {}, "_fields": {},
+	"_search": {}, "_bbox": {}, "_near": {}, "_radius_km": {},
+}
+
+// listingOptions copies the pagination options and column filters
+// in the URL query into opts for the Driver.Listing call.
+func listingOptions(tab bdog.Table, uq url.Values, opts map[string][]string) {
+	for varName, vals := range uq {
+		if _, ok := listingOptionNames[varName]; ok {
+			opts[varName] = vals
+			continue
+		}
+		if varName == "_q" || (varName == "filter" && !tab.HasColumn(varName)) {
+			opts["_q"] = append(opts["_q"], vals...)
+			continue
+		}
+
+		// anything using the column[op] syntax is validated by the driver
+		col, _ := bdog.ParseFilterName(varName)
+		if col != varName || tab.HasColumn(col) {
+			opts[varName] = vals
+			opts["_filters"] = append(opts["_filters"], varName)
+		}
+	}
+}
+
+// writeListing runs the listing query for opts and writes the results in the
+// format. Unpaginated results in streamed formats are written as each row is
+// read if the Driver is a bdog.Iterator, otherwise results are collected first
+// so that the pagination headers can link to the next page.
+func (c *Controller) writeListing(w http.ResponseWriter, r *http.Request, tab bdog.Table, format listingFormat, opts map[string][]string) {
+	var lw listingWriter
+	// begin writes the headers, so errors must be handled before it is called
+	begin := func(data []interface{}) error {
+		if _, all := opts["_unlimited"]; !all {
+			if err := paginationHeaders(w, r, tab, opts, data); err != nil {
+				return err
+			}
+		}
+		w.Header().Set("Content-Type", format.mediaType)
+		if format.export {
+			w.Header().Set("Content-Disposition", `attachment; filename="`+tab.PluralName(false)+format.extension+`"`)
+		}
+		var err error
+		lw, err = format.newWriter(w, tab, opts)
+		return err
+	}
+	listError := func(err error) {
+		log.Println(err)
+		if errors.Is(err, bdog.ErrInvalidFilter) {
+			detailedError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err == bdog.ErrInvalidInclude {
+			basicError(w, http.StatusBadRequest)
+			return
+		}
+		basicError(w, http.StatusInternalServerError)
+	}
+
+	// included data is fetched in batches, so can't be streamed
+	iter, canStream := tab.Driver.(bdog.Iterator)
+	if _, nested := opts["_nest"]; nested {
+		canStream = false
+	}
+	// a page must be complete to know whether to link to the next page
+	if _, all := opts["_unlimited"]; !all {
+		canStream = false
+	}
+	if !format.stream || !canStream {
+		data, err := tab.Driver.Listing(tab, opts)
+		if err != nil {
+			listError(err)
+			return
+		}
+		if err = begin(data); err != nil {
+			listError(err)
+			return
+		}
+		for _, row := range data {
+			if err = lw.WriteRow(row.(map[string]interface{})); err != nil {
+				log.Println(err)
+				return
+			}
+		}
+		if err = lw.Close(); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+
+	n := 0
+	flusher, _ := w.(http.Flusher)
+	err := iter.Each(tab, opts, func(row map[string]interface{}) error {
+		if lw == nil {
+			if err := begin(nil); err != nil {
+				return err
+			}
+		}
+		if err := lw.WriteRow(row); err != nil {
+			return err
+		}
+		n++
+		if flusher != nil && (n == 1 || n%flushRows == 0) {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if lw == nil {
+			listError(err)
+		} else {
+			// too late to report an error to the client
+			log.Println(err)
+		}
+		return
+	}
+	if lw == nil {
+		if err = begin(nil); err != nil {
+			listError(err)
+			return
+		}
+	}
+	if err = lw.Close(); err != nil {
+		log.Println(err)
+	}
+}
+
+// flushRows is the number of streamed rows to write between flushes.
+const flushRows = 100
+
 // Listing creates a "listing" GET endpoint for the table.
 func (c *Controller) Listing(table string) {
-	tab := c.mod.GetTable(table)
+	tab := c.getTable(table)
 	drv := tab.Driver
 
 	route := "/" + tab.PluralName(false)
 	log.Println("GET", route)
 	apiList := c.apiSpec.NewHandler("GET", route)
 	apiList.Summary = "List " + tab.PluralName(true)
-	apiList.Parameters = append(apiList.Parameters, APIParameter{
-		Name:        "_page",
-		In:          "query",
-		Description: "Page number to return (default=1)",
-		Schema:      APISchemaType{Type: "integer", Default: 1},
-	}, APIParameter{
-		Name:        "_perpage",
-		In:          "query",
-		Description: "Number of " + tab.PluralName(true) + " per page to return (default=25)",
-		Schema:      APISchemaType{Type: "integer", Default: 25},
-	}, APIParameter{
-		Name:        "_sortby",
-		In:          "query",
-		Description: "Field to sort the results by (default=" + strings.Join(tab.Key, ", ") + ")",
-		Schema:      APISchemaType{Type: "string", Default: strings.Join(tab.Key, ", ")},
-	})
+	apiList.Description = filterDescription
+	apiList.Parameters = append(apiList.Parameters, paginationParameters(tab)...)
+	apiList.Parameters = append(apiList.Parameters, sortParameter(tab), nullsParameter, filterParameter, fieldsParameter(tab))
+	if tab.IsSearchable() {
+		apiList.Parameters = append(apiList.Parameters, searchParameter)
+	}
+	apiList.Parameters = append(apiList.Parameters, geoParameters(tab)...)
+	apiList.Parameters = append(apiList.Parameters, formatParameter(tab))
+	includeMap, relIncludes := c.includes(table)
+	if len(relIncludes) > 0 {
+		apiList.Parameters = append(apiList.Parameters, includeParameter(relIncludes))
+	}
 
 	example, err := drv.Listing(tab, nil)
 	if err == nil {
 		apiList.AddExampleResponse(apiList.Summary, example)
 	}
+	apiList.AddPaginationHeaders()
+	for _, name := range availableFormats(tab) {
+		apiList.AddResponseFormat(listingFormats[name].mediaType)
+	}
 
 	c.router.GET(route, func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 		if r.Method != http.MethodGet {
@@ -50,7 +388,11 @@ func (c *Controller) Listing(table string) {
 		if c.CORSEnabled {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 		}
-		w.Header().Set("Content-Type", "application/json")
+		format, err := requestFormat(tab, r)
+		if err != nil {
+			detailedError(w, http.StatusBadRequest, err)
+			return
+		}
 
 		opts := make(map[string][]string)
 		for _, colname := range tab.Key {
@@ -58,38 +400,18 @@ func (c *Controller) Listing(table string) {
 			opts[colname] = append(opts[colname], key)
 		}
 
-		uq := r.URL.Query()
-		for varName, vals := range uq {
-			if varName == "_page" || varName == "_perpage" || varName == "_sortby" {
-				opts[varName] = vals
-				continue
-			}
-
-			for _, col := range tab.Columns {
-				if col == varName {
-					opts[varName] = vals
-					opts["_filters"] = append(opts["_filters"], varName)
-				}
-			}
-		}
-
-		data, err := drv.Listing(tab, opts)
-		if err != nil {
-			log.Println(err)
-			if err == bdog.ErrInvalidFilter {
-				basicError(w, http.StatusBadRequest)
-				return
-			}
-			basicError(w, http.StatusInternalServerError)
+		listingOptions(tab, r.URL.Query(), opts)
+		if err := includeOptions(r.URL.Query(), includeMap, relIncludes, opts); err != nil {
+			detailedError(w, http.StatusBadRequest, err)
 			return
 		}
-
-		err = json.NewEncoder(w).Encode(data)
+		err = c.prepareListing(tab, format, opts)
 		if err != nil {
-			log.Println(err)
-			basicError(w, http.StatusInternalServerError)
+			detailedError(w, http.StatusBadRequest, err)
 			return
 		}
+
+		c.writeListing(w, r, tab, format, opts)
 	})
 }
 
@@ -97,32 +419,43 @@ func (c *Controller) Listing(table string) {
 // Aka a one-to-many relationship (e.g. /invoices/1234/products to list Multiple Products
 // bought on a single Invoice)
 func (c *Controller) ListingFromSingle(table1, table2 string) {
-	tab1 := c.mod.GetTable(table1)
 	tab2 := c.mod.GetTable(table2)
+	c.ListingFromRelation(table1, bdog.Relation{Name: tab2.PluralName(false), Table: table2})
+}
+
+// ListingFromRelation exposes a list of the items related to a specified <table1>
+// item by a to-many relation, using the relation name in the route (e.g.
+// /airports/KJFK/flights_as_origin). Only the relation's foreign key Columns are
+// matched, or all links between the tables if it has none.
+func (c *Controller) ListingFromRelation(table1 string, rel bdog.Relation) {
+	tab1 := c.mod.GetTable(table1)
+	tab2 := c.getTable(rel.Table)
+	table2 := rel.Table
 	drv := tab1.Driver
 	keypath := ":" + strings.Join(tab1.Key, "/:")
 
-	route := "/" + tab1.PluralName(false) + "/" + keypath + "/" + tab2.PluralName(false)
+	route := "/" + tab1.PluralName(false) + "/" + keypath + "/" + rel.Name
 	log.Println("GET", route)
 
 	apiList2 := c.apiSpec.NewHandler("GET", route)
 	apiList2.Summary = "List " + tab2.PluralName(true) + " linked to a given " + tab1.SingleName(true)
-	apiList2.Parameters = append(apiList2.Parameters, APIParameter{
-		Name:        "_page",
-		In:          "query",
-		Description: "Page number to return (default=1)",
-		Schema:      APISchemaType{Type: "integer", Default: 1},
-	}, APIParameter{
-		Name:        "_perpage",
-		In:          "query",
-		Description: "Number of " + tab2.PluralName(true) + " per page to return (default=25)",
-		Schema:      APISchemaType{Type: "integer", Default: 25},
-	}, APIParameter{
-		Name:        "_sortby",
-		In:          "query",
-		Description: "Field to sort the results by (default=" + strings.Join(tab2.Key, ", ") + ")",
-		Schema:      APISchemaType{Type: "string", Default: strings.Join(tab2.Key, ", ")},
-	})
+	if rel.Columns != nil && rel.Name != tab2.PluralName(false) {
+		apiList2.Summary += " by " + strings.Join(rel.Columns, ", ")
+	} else if rel.Junction != "" && rel.Name != tab2.PluralName(false) {
+		apiList2.Summary += " through " + rel.Junction
+	}
+	apiList2.Description = filterDescription
+	apiList2.Parameters = append(apiList2.Parameters, paginationParameters(tab2)...)
+	apiList2.Parameters = append(apiList2.Parameters, sortParameter(tab2), nullsParameter, filterParameter, fieldsParameter(tab2))
+	if tab2.IsSearchable() {
+		apiList2.Parameters = append(apiList2.Parameters, searchParameter)
+	}
+	apiList2.Parameters = append(apiList2.Parameters, geoParameters(tab2)...)
+	apiList2.Parameters = append(apiList2.Parameters, formatParameter(tab2))
+	includeMap, relIncludes := c.includes(table2)
+	if len(relIncludes) > 0 {
+		apiList2.Parameters = append(apiList2.Parameters, includeParameter(relIncludes))
+	}
 
 	// TODO: this might not be a good/valid example if e.g. there are
 	// no table2's linked to this particular table1 entity.
@@ -137,6 +470,10 @@ func (c *Controller) ListingFromSingle(table1, table2 string) {
 		}
 		apiList2.AddExampleResponse(apiList2.Summary, examples2)
 	}
+	apiList2.AddPaginationHeaders()
+	for _, name := range availableFormats(tab2) {
+		apiList2.AddResponseFormat(listingFormats[name].mediaType)
+	}
 
 	c.router.GET(route, func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 		if r.Method != http.MethodGet {
@@ -146,44 +483,31 @@ func (c *Controller) ListingFromSingle(table1, table2 string) {
 		if c.CORSEnabled {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 		}
-		w.Header().Set("Content-Type", "application/json")
-
-		key := params.ByName(tab1.Key[0])
-		opts := make(map[string][]string)
-
-		uq := r.URL.Query()
-		for varName, vals := range uq {
-			if varName == "_page" || varName == "_perpage" || varName == "_sortby" {
-				opts[varName] = vals
-				continue
-			}
-
-			for _, col := range tab2.Columns {
-				if col == varName {
-					opts[varName] = vals
-					opts["_filters"] = append(opts["_filters"], varName)
-				}
-			}
+		format, err := requestFormat(tab2, r)
+		if err != nil {
+			detailedError(w, http.StatusBadRequest, err)
+			return
 		}
 
-		c.mod.GetSubqueryMapping(tab1, tab2, key, opts)
+		key := make([]string, len(tab1.Key))
+		for i, colname := range tab1.Key {
+			key[i] = params.ByName(colname)
+		}
+		opts := make(map[string][]string)
 
-		data, err := drv.Listing(tab2, opts)
-		if err != nil {
-			log.Println(err)
-			if err == bdog.ErrInvalidInclude {
-				basicError(w, http.StatusBadRequest)
-				return
-			}
-			basicError(w, http.StatusInternalServerError)
+		listingOptions(tab2, r.URL.Query(), opts)
+		if err := includeOptions(r.URL.Query(), includeMap, relIncludes, opts); err != nil {
+			detailedError(w, http.StatusBadRequest, err)
 			return
 		}
-
-		err = json.NewEncoder(w).Encode(data)
+		err = c.prepareListing(tab2, format, opts)
 		if err != nil {
-			log.Println(err)
-			basicError(w, http.StatusInternalServerError)
+			detailedError(w, http.StatusBadRequest, err)
 			return
 		}
+
+		c.subqueryMapping(tab1, tab2, rel, key, opts)
+
+		c.writeListing(w, r, tab2, format, opts)
 	})
 }
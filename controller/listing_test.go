@@ -0,0 +1,235 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pbnjay/bdog/analyzer"
+	"github.com/pbnjay/bdog/drivers/sqlite3"
+)
+
+// compositeKeysHandler serves the API for a sqlite database loaded with
+// examples/composite_keys_schema.sql.
+func compositeKeysHandler(t *testing.T) http.Handler {
+	t.Helper()
+	schema, err := os.ReadFile(filepath.Join("..", "examples", "composite_keys_schema.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sqliteHandler(t, string(schema))
+}
+
+// sqliteHandler serves the API for a sqlite database loaded with schema.
+func sqliteHandler(t *testing.T, schema string) http.Handler {
+	t.Helper()
+	return sqliteController(t, schema).GenerateRoutes("")
+}
+
+// sqliteController creates a Controller for a sqlite database loaded with
+// schema, along with its Cardinality analysis.
+func sqliteController(t *testing.T, schema string) *Controller {
+	t.Helper()
+	dbName := filepath.Join(t.TempDir(), "test.sqlite")
+	conn, err := sql.Open("sqlite3", dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(schema)
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mod, err := sqlite3.Open(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New("test", "1.0", mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Cardinality, err = analyzer.NewCardinality(mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestListingFromSingleCompositeKey(t *testing.T) {
+	h := compositeKeysHandler(t)
+	for _, tc := range []struct {
+		path        string
+		dept        string
+		number      float64
+		instructors []string
+	}{
+		{"/courses/MATH/101/sections", "MATH", 101, []string{"Noether"}},
+		{"/courses/CS/101/sections", "CS", 101, []string{"Hopper", "Lovelace", "Hopper"}},
+		{"/courses/CS/201/sections", "CS", 201, []string{"Knuth"}},
+		{"/courses/MATH/201/sections", "MATH", 201, []string{}},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+			}
+			var rows []map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &rows); err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != len(tc.instructors) {
+				t.Fatalf("got %d sections, want %d: %v", len(rows), len(tc.instructors), rows)
+			}
+			for i, row := range rows {
+				if row["dept"] != tc.dept || row["course_number"] != tc.number {
+					t.Errorf("row %d is for course %v %v", i, row["dept"], row["course_number"])
+				}
+				if row["instructor"] != tc.instructors[i] {
+					t.Errorf("row %d instructor = %v, want %s", i, row["instructor"], tc.instructors[i])
+				}
+			}
+		})
+	}
+}
+
+func TestListingNextCursor(t *testing.T) {
+	h := sqliteHandler(t, `CREATE TABLE widgets (id INTEGER PRIMARY KEY, name TEXT NOT NULL, active BOOLEAN NOT NULL);
+		INSERT INTO widgets (name, active) VALUES ('a', 1), ('b', 0), ('c', 1), ('d', 0), ('e', 1);`)
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"_perpage=2", []string{"a", "b", "c", "d", "e"}},
+		{"_perpage=2&_sortby=-name", []string{"e", "d", "c", "b", "a"}},
+		{"_perpage=2&_sortby=active,-name", []string{"d", "b", "e", "c", "a"}},
+		{"_perpage=1&_sortby=-active,name&active=true", []string{"a", "c", "e"}},
+	} {
+		var got []string
+		path := "/widgets?" + tc.query
+		for len(got) <= len(tc.want) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s: status = %d: %s", path, rec.Code, rec.Body.String())
+			}
+			var rows []map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &rows); err != nil {
+				t.Fatal(err)
+			}
+			for _, row := range rows {
+				got = append(got, row["name"].(string))
+			}
+			next := rec.Header().Get("X-Next-Cursor")
+			if next == "" {
+				break
+			}
+			path = "/widgets?" + tc.query + "&_cursor=" + next
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestSingleEmbedNonIntegerKey(t *testing.T) {
+	h := sqliteHandler(t, `CREATE TABLE gauges (reading REAL PRIMARY KEY, name TEXT UNIQUE);
+		CREATE TABLE samples (id INTEGER PRIMARY KEY, reading REAL REFERENCES gauges(reading), note TEXT);
+		CREATE TABLE modes (enabled BOOLEAN PRIMARY KEY, label TEXT UNIQUE);
+		CREATE TABLE options (id INTEGER PRIMARY KEY, enabled BOOLEAN REFERENCES modes(enabled), note TEXT);
+		INSERT INTO gauges VALUES (1000000, 'big'), (0.5, 'small');
+		INSERT INTO samples (reading, note) VALUES (1000000, 'a'), (0.5, 'b'), (1000000, 'c');
+		INSERT INTO modes VALUES (1, 'on'), (0, 'off');
+		INSERT INTO options (enabled, note) VALUES (0, 'a'), (1, 'b');`)
+	for _, tc := range []struct {
+		path string
+		want []string
+	}{
+		{"/gauges/1000000?embed=samples", []string{"a", "c"}},
+		{"/gauges/0.5?embed=samples", []string{"b"}},
+		{"/gauges/big?embed=samples", []string{"a", "c"}},
+		{"/modes/1?embed=options", []string{"b"}},
+		{"/modes/off?embed=options", []string{"a"}},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", tc.path, rec.Code, rec.Body.String())
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &data); err != nil {
+			t.Fatal(err)
+		}
+		embed := tc.path[strings.Index(tc.path, "=")+1:]
+		rows, _ := data[embed].([]interface{})
+		var got []string
+		for _, row := range rows {
+			got = append(got, row.(map[string]interface{})["note"].(string))
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s embedded %v, want %v", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestListingPaginationHeaders(t *testing.T) {
+	h := sqliteHandler(t, `CREATE TABLE widgets (id INTEGER PRIMARY KEY, color TEXT);
+		INSERT INTO widgets (color) VALUES ('red'), ('blue'), ('red'), ('red'), ('blue'), ('red'), ('red');`)
+	for _, tc := range []struct {
+		query string
+		code  int
+		count string
+		links []string
+	}{
+		{"color=red&_perpage=2&_count=1", http.StatusOK, "5", []string{
+			`</widgets?_count=1&_page=1&_perpage=2&color=red>; rel="first"`,
+			`</widgets?_count=1&_page=2&_perpage=2&color=red>; rel="next"`,
+			`</widgets?_count=1&_page=3&_perpage=2&color=red>; rel="last"`,
+		}},
+		{"color=red&_perpage=2&_count=1&_page=2", http.StatusOK, "5", []string{
+			`</widgets?_count=1&_page=1&_perpage=2&color=red>; rel="first"`,
+			`</widgets?_count=1&_page=1&_perpage=2&color=red>; rel="prev"`,
+			`</widgets?_count=1&_page=3&_perpage=2&color=red>; rel="next"`,
+			`</widgets?_count=1&_page=3&_perpage=2&color=red>; rel="last"`,
+		}},
+		{"color=red&_perpage=2&_count=1&_page=3", http.StatusOK, "5", []string{
+			`</widgets?_count=1&_page=1&_perpage=2&color=red>; rel="first"`,
+			`</widgets?_count=1&_page=2&_perpage=2&color=red>; rel="prev"`,
+			`</widgets?_count=1&_page=3&_perpage=2&color=red>; rel="last"`,
+		}},
+		{"color=blue&_perpage=2", http.StatusOK, "", []string{
+			`</widgets?_page=1&_perpage=2&color=blue>; rel="first"`,
+			`</widgets?_page=2&_perpage=2&color=blue>; rel="next"`,
+		}},
+		{"color=green&_count=1", http.StatusOK, "0", []string{
+			`</widgets?_count=1&_page=1&color=green>; rel="first"`,
+			`</widgets?_count=1&_page=1&color=green>; rel="last"`,
+		}},
+		{"_page=99999999999999999&_perpage=500", http.StatusBadRequest, "", nil},
+		{"_page=99999999999999999&_perpage=500&format=csv", http.StatusBadRequest, "", nil},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/widgets?"+tc.query, nil))
+		if rec.Code != tc.code {
+			t.Errorf("%s: status = %d, want %d: %s", tc.query, rec.Code, tc.code, rec.Body.String())
+			continue
+		}
+		if tc.code != http.StatusOK {
+			continue
+		}
+		if got := rec.Header().Get("X-Total-Count"); got != tc.count {
+			t.Errorf("%s: X-Total-Count = %q, want %q", tc.query, got, tc.count)
+		}
+		if got, want := rec.Header().Get("Link"), strings.Join(tc.links, ", "); got != want {
+			t.Errorf("%s: Link = %s, want %s", tc.query, got, want)
+		}
+	}
+}
@@ -29,14 +29,16 @@ type APIServer struct {
 type APIPath struct {
 	Get    *APIOperation `json:"get,omitempty"`
 	Patch  *APIOperation `json:"patch,omitempty"`
+	Put    *APIOperation `json:"put,omitempty"`
 	Post   *APIOperation `json:"post,omitempty"`
 	Delete *APIOperation `json:"delete,omitempty"`
 }
 
 type APIOperation struct {
-	Summary    string                 `json:"summary"`
-	Parameters []APIParameter         `json:"parameters,omitempty"`
-	Responses  map[string]APIResponse `json:"responses"`
+	Summary     string                 `json:"summary"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  []APIParameter         `json:"parameters,omitempty"`
+	Responses   map[string]APIResponse `json:"responses"`
 }
 
 type APIParameter struct {
@@ -46,6 +48,11 @@ type APIParameter struct {
 	Required    bool          `json:"required"`
 	Schema      APISchemaType `json:"schema"`
 	Example     string        `json:"example,omitempty"`
+
+	// Style and Explode describe how array values are serialized,
+	// e.g. "form" and false for comma-separated values.
+	Style   string `json:"style,omitempty"`
+	Explode *bool  `json:"explode,omitempty"`
 }
 
 type APISchemaType struct {
@@ -54,13 +61,22 @@ type APISchemaType struct {
 	Maximum int         `json:"maximum,omitempty"`
 	Default interface{} `json:"default,omitempty"`
 	Enum    []string    `json:"enum,omitempty"`
+
+	// if type is "array", this is the element type contained
+	Items *APISchemaType `json:"items,omitempty"`
 }
 
 type APIResponse struct {
 	Description string                    `json:"description"`
+	Headers     map[string]APIHeader      `json:"headers,omitempty"`
 	Content     map[string]APIContentType `json:"content,omitempty"`
 }
 
+type APIHeader struct {
+	Description string        `json:"description,omitempty"`
+	Schema      APISchemaType `json:"schema"`
+}
+
 type APIContentType struct {
 	Schema  *JSONSchemaType `json:"schema,omitempty"`
 	Example interface{}     `json:"example,omitempty"`
@@ -86,6 +102,26 @@ type JSONSchemaType struct {
 	Required []string `json:"required,omitempty"`
 }
 
+// jsonTypeOf returns the JSON schema type name for a decoded JSON value.
+func jsonTypeOf(v interface{}) string {
+	switch v.(type) {
+	case int64, float64, json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string, nil:
+		// NULL values give no hint, so assume string
+		return "string"
+	default:
+		log.Printf("UNHANDLED TYPE %T", v)
+	}
+	return "string"
+}
+
 func (s *APIOperation) AddExampleResponse(desc string, data interface{}) {
 	dataSchema := JSONSchemaType{
 		//JSONSchemaRef: "http://json-schema.org/draft-04/schema#",
@@ -104,17 +140,10 @@ func (s *APIOperation) AddExampleResponse(desc string, data interface{}) {
 		}
 		x := []map[string]interface{}{}
 		json.Unmarshal(jb, &x)
-		for k, v := range x[0] {
-			t := "string"
-			switch v.(type) {
-			case int64, float64, json.Number:
-				t = "number"
-			case string:
-				t = "string"
-			default:
-				log.Printf("UNHANDLED TYPE %T", v)
+		if len(x) > 0 {
+			for k, v := range x[0] {
+				dataSchema.Items.Properties[k] = JSONSchemaType{Type: jsonTypeOf(v)}
 			}
-			dataSchema.Items.Properties[k] = JSONSchemaType{Type: t}
 		}
 
 	} else {
@@ -123,16 +152,7 @@ func (s *APIOperation) AddExampleResponse(desc string, data interface{}) {
 		x := map[string]interface{}{}
 		json.Unmarshal(jb, &x)
 		for k, v := range x {
-			t := "string"
-			switch v.(type) {
-			case int64, float64, json.Number:
-				t = "number"
-			case string:
-				t = "string"
-			default:
-				log.Printf("UNHANDLED TYPE %T", v)
-			}
-			dataSchema.Properties[k] = JSONSchemaType{Type: t}
+			dataSchema.Properties[k] = JSONSchemaType{Type: jsonTypeOf(v)}
 		}
 	}
 
@@ -147,6 +167,41 @@ func (s *APIOperation) AddExampleResponse(desc string, data interface{}) {
 	}
 }
 
+// AddPaginationHeaders documents the Link, X-Total-Count and X-Next-Cursor headers
+// in the successful response of a listing operation.
+func (s *APIOperation) AddPaginationHeaders() {
+	resp := s.Responses["200"]
+	resp.Headers = map[string]APIHeader{
+		"Link": {
+			Description: "RFC 8288 links to the first, prev, next and last pages of results",
+			Schema:      APISchemaType{Type: "string"},
+		},
+		"X-Total-Count": {
+			Description: "Total number of results (only if _count=true was requested)",
+			Schema:      APISchemaType{Type: "integer"},
+		},
+		"X-Next-Cursor": {
+			Description: "Cursor to pass as _cursor to fetch the next page of results (only if the sort fields cannot be empty)",
+			Schema:      APISchemaType{Type: "string"},
+		},
+	}
+	s.Responses["200"] = resp
+}
+
+// AddResponseFormat documents another media type for the successful response
+// of an operation, e.g. for alternative output formats.
+func (s *APIOperation) AddResponseFormat(mediaType string) {
+	resp := s.Responses["200"]
+	if _, exists := resp.Content[mediaType]; exists {
+		return
+	}
+	if resp.Content == nil {
+		resp.Content = make(map[string]APIContentType)
+	}
+	resp.Content[mediaType] = APIContentType{}
+	s.Responses["200"] = resp
+}
+
 func (s *OpenAPI) NewHandler(method, path string) *APIOperation {
 	defaultResponseCode := "200"
 	switch strings.ToUpper(method) {
@@ -195,12 +250,14 @@ func (s *OpenAPI) NewHandler(method, path string) *APIOperation {
 		s.Paths[path].Get = newOp
 	case "patch":
 		s.Paths[path].Patch = newOp
+	case "put":
+		s.Paths[path].Put = newOp
 	case "post":
 		s.Paths[path].Post = newOp
 	case "delete":
 		s.Paths[path].Delete = newOp
 	default:
-		panic("method type not supported (only get,patch,post,delete)")
+		panic("method type not supported (only get,patch,put,post,delete)")
 	}
 	return newOp
 }
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRelationsNamedByForeignKey(t *testing.T) {
+	h := sqliteHandler(t, `CREATE TABLE airports (ident TEXT PRIMARY KEY, name TEXT);
+		CREATE TABLE airlines (code TEXT PRIMARY KEY, name TEXT);
+		CREATE TABLE flights (id INTEGER PRIMARY KEY, airline_code TEXT REFERENCES airlines(code),
+			origin_id TEXT REFERENCES airports(ident), destination_id TEXT REFERENCES airports(ident));
+		INSERT INTO airports VALUES ('KCLT', 'Charlotte'), ('KRDU', 'Raleigh-Durham'), ('KJFK', 'New York');
+		INSERT INTO airlines VALUES ('AA', 'American');
+		INSERT INTO flights VALUES (1, 'AA', 'KCLT', 'KRDU'), (2, 'AA', 'KRDU', 'KJFK'), (3, 'AA', 'KCLT', 'KJFK');`)
+
+	get := func(path string, v interface{}) bool {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status = %d: %s", path, rec.Code, rec.Body.String())
+			return false
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatal(err)
+		}
+		return true
+	}
+
+	var flight map[string]interface{}
+	if get("/flights/1?include=origin,destination,airline", &flight) {
+		for name, want := range map[string]string{"origin": "Charlotte", "destination": "Raleigh-Durham", "airline": "American"} {
+			if linked, _ := flight[name].(map[string]interface{}); linked["name"] != want {
+				t.Errorf("flight 1 %s = %v, want %s", name, flight[name], want)
+			}
+		}
+	}
+	var flights []map[string]interface{}
+	if get("/flights?include=destination", &flights) {
+		for i, want := range []string{"KRDU", "KJFK", "KJFK"} {
+			if linked, _ := flights[i]["destination"].(map[string]interface{}); linked["ident"] != want {
+				t.Errorf("flight %d destination = %v, want %s", i+1, flights[i]["destination"], want)
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		path string
+		ids  []float64
+	}{
+		{"/airports/KCLT/flights_as_origin", []float64{1, 3}},
+		{"/airports/KCLT/flights_as_destination", []float64{}},
+		{"/airports/KJFK/flights_as_destination", []float64{2, 3}},
+		{"/airlines/AA/flights", []float64{1, 2, 3}},
+	} {
+		var rows []map[string]interface{}
+		if !get(tc.path, &rows) {
+			continue
+		}
+		ids := []float64{}
+		for _, row := range rows {
+			ids = append(ids, row["id"].(float64))
+		}
+		if !reflect.DeepEqual(ids, tc.ids) {
+			t.Errorf("%s = flights %v, want %v", tc.path, ids, tc.ids)
+		}
+	}
+
+	for _, path := range []string{"/flights/1?include=airport", "/airports/KCLT/flights"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code == http.StatusOK {
+			t.Errorf("%s: status = %d, want an error for the ambiguous name", path, rec.Code)
+		}
+	}
+}
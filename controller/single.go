@@ -2,15 +2,112 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/pbnjay/bdog"
 )
 
+// toOneLinks returns a map from the names accepted for the to-one relations of
+// the table (the relation names, or table names for relations named after the
+// table) to the relations, and the sorted list of relation names.
+func (c *Controller) toOneLinks(table string) (map[string]bdog.Relation, []string) {
+	tab := c.mod.GetTable(table)
+	linkMap := make(map[string]bdog.Relation)
+	var names []string
+	for _, rel := range tab.Relations(c.mod.GetTable) {
+		names = append(names, rel.Name)
+		linkMap[rel.Name] = rel
+	}
+	for _, rel := range linkMap {
+		// table names are also accepted, e.g. include=regions
+		otherTab := c.mod.GetTable(rel.Table)
+		if _, dup := linkMap[rel.Table]; !dup && rel.Name == otherTab.SingleName(false) {
+			linkMap[rel.Table] = rel
+		}
+	}
+	return linkMap, names
+}
+
+// includes returns a map from the "include" paths for the table to the
+// dot-separated relation names to nest, and the sorted list of paths using
+// relation names. Paths follow to-one relations up to MaxIncludeDepth deep,
+// e.g. "region.country" (or "regions.countries") includes the region and the
+// region's country.
+func (c *Controller) includes(table string) (map[string]string, []string) {
+	type includePath struct {
+		name, relations, table string
+		// canonical is true if name only uses relation names
+		canonical bool
+	}
+	includeMap := make(map[string]string)
+	var names []string
+
+	level := []includePath{{table: table, canonical: true}}
+	for depth := 0; depth < c.MaxIncludeDepth || depth == 0; depth++ {
+		var next []includePath
+		for _, from := range level {
+			linkMap, _ := c.toOneLinks(from.table)
+			for name, rel := range linkMap {
+				p := includePath{name: name, relations: rel.Name, table: rel.Table}
+				if from.name != "" {
+					p.name = from.name + "." + name
+					p.relations = from.relations + "." + rel.Name
+				}
+				p.canonical = from.canonical && name == rel.Name
+				if _, dup := includeMap[p.name]; dup {
+					continue
+				}
+				includeMap[p.name] = p.relations
+				if p.canonical {
+					names = append(names, p.name)
+				}
+				next = append(next, p)
+			}
+		}
+		level = next
+	}
+	sort.Strings(names)
+	return includeMap, names
+}
+
+// includeParameter describes the "include" option.
+func includeParameter(names []string) APIParameter {
+	noExplode := false
+	return APIParameter{
+		Name:        "include",
+		In:          "query",
+		Description: "include linked records (or records linked to them, using dotted paths), nested in the result. available options: " + strings.Join(names, ", "),
+		Schema: APISchemaType{
+			Type:  "array",
+			Items: &APISchemaType{Type: "string", Enum: names},
+		},
+		Style:   "form",
+		Explode: &noExplode,
+	}
+}
+
+// includeOptions adds the relation paths to nest for the "include" names in
+// the URL query to opts. Names can be repeated or comma-separated.
+func includeOptions(uq url.Values, includeMap map[string]string, names []string, opts map[string][]string) error {
+	for _, inc := range uq["include"] {
+		for _, incName := range strings.Split(inc, ",") {
+			incTabName, validInclude := includeMap[incName]
+			if !validInclude {
+				return fmt.Errorf("invalid include '%s' (available: %s)", incName, strings.Join(names, ", "))
+			}
+			opts["_nest"] = append(opts["_nest"], incTabName)
+		}
+	}
+	return nil
+}
+
 func (c *Controller) Single(table string) {
 	tab := c.mod.GetTable(table)
 	drv := tab.Driver
@@ -31,39 +128,21 @@ func (c *Controller) Single(table string) {
 		apiGet.AddExampleResponse("The requested "+tab.SingleName(true)+" details", example)
 	}
 
-	// map from the "include" singular label to the table name
-	includeMap := make(map[string]string)
-	relIncludes := []string{}
-	rels := c.mod.ListRelatedTableNames(table)
-	if len(rels) > 0 {
-
-		for _, other := range rels {
-			otherTab := c.mod.GetTable(other)
-			colmaps := c.mod.GetRelatedTableMappings(table, other)
-
-			for _, rights := range colmaps {
-				for _, right := range rights {
-					// if <right> is the PK for <other> then this is a to-one relationship, ok to nest:
-					if otherTab.Key.IsEqual(right) {
-						oname := otherTab.SingleName(false)
-						log.Printf("GET %s?include=%s", route, oname)
-						relIncludes = append(relIncludes, oname)
-
-						includeMap[oname] = otherTab.Name
-					}
-				}
-			}
-		}
-
-		if len(relIncludes) > 0 {
-			apiGet.Parameters = append(apiGet.Parameters, APIParameter{
-				Name:        "include",
-				In:          "query",
-				Description: "include linked records, nested in the result. available options: " + strings.Join(relIncludes, ", "),
-				Schema:      APISchemaType{Type: "string", Enum: relIncludes},
-			})
-		}
+	includeMap, relIncludes := c.includes(table)
+	for _, oname := range relIncludes {
+		log.Printf("GET %s?include=%s", route, oname)
+	}
+	if len(relIncludes) > 0 {
+		apiGet.Parameters = append(apiGet.Parameters, includeParameter(relIncludes))
+	}
+	embedMap, relEmbeds := c.embeds(table)
+	for _, cname := range relEmbeds {
+		log.Printf("GET %s?embed=%s", route, cname)
 	}
+	if len(relEmbeds) > 0 {
+		apiGet.Parameters = append(apiGet.Parameters, embedParameters(relEmbeds)...)
+	}
+	apiGet.Parameters = append(apiGet.Parameters, fieldsParameter(tab))
 
 	c.router.GET(route, func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 		if r.Method != http.MethodGet {
@@ -76,22 +155,24 @@ func (c *Controller) Single(table string) {
 		w.Header().Set("Content-Type", "application/json")
 
 		opts := make(map[string][]string)
-		for _, colname := range tab.Key {
-			key := params.ByName(colname)
-			opts[colname] = append(opts[colname], key)
+		key := make([]string, len(tab.Key))
+		for i, colname := range tab.Key {
+			key[i] = params.ByName(colname)
+			opts[colname] = append(opts[colname], key[i])
 		}
 
 		uq := r.URL.Query()
-		if len(uq["include"]) != 0 {
-			for _, incName := range uq["include"] {
-				incTabName, validInclude := includeMap[incName]
-				if !validInclude {
-					fmt.Fprintf(w, "Invalid 'include' given. Available options are: "+strings.Join(relIncludes, ", "))
-					basicError(w, http.StatusBadRequest)
-					return
-				}
-				opts["_nest"] = append(opts["_nest"], incTabName)
-			}
+		if fields, ok := uq["_fields"]; ok {
+			opts["_fields"] = fields
+		}
+		if err := includeOptions(uq, includeMap, relIncludes, opts); err != nil {
+			detailedError(w, http.StatusBadRequest, err)
+			return
+		}
+		embedOpts, err := c.embedOptions(uq, embedMap, relEmbeds)
+		if err != nil {
+			detailedError(w, http.StatusBadRequest, err)
+			return
 		}
 
 		data, err := drv.Get(tab, opts)
@@ -99,18 +180,26 @@ func (c *Controller) Single(table string) {
 			// secondary check for unique key as the lookup
 			qval := opts[tab.Key[0]]
 			nested, hasNest := opts["_nest"]
+			fields, hasFields := opts["_fields"]
 			for _, colname := range tab.UniqueColumns {
 				opts = make(map[string][]string)
 				opts[colname] = qval
 				if hasNest {
 					opts["_nest"] = nested
 				}
+				if hasFields {
+					opts["_fields"] = fields
+				}
 				data, err = drv.Get(tab, opts)
 				if err == nil {
+					key[0] = tab.ColumnInfo[tab.Key[0]].Format(data[tab.Key[0]])
 					break
 				}
 			}
 		}
+		if err == nil && len(embedOpts) > 0 {
+			err = c.embedLinked(data, tab, key, embedMap, embedOpts)
+		}
 		if err != nil {
 			log.Println(err)
 			if err == bdog.ErrNotFound {
@@ -121,6 +210,10 @@ func (c *Controller) Single(table string) {
 				basicError(w, http.StatusBadRequest)
 				return
 			}
+			if errors.Is(err, bdog.ErrInvalidFilter) {
+				detailedError(w, http.StatusBadRequest, err)
+				return
+			}
 			basicError(w, http.StatusInternalServerError)
 			return
 		}
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pbnjay/bdog"
+)
+
+// Tree creates "_ancestors" and "_descendants" GET endpoints for a table with
+// a "parent" relation (a foreign key to itself), listing the rows above or
+// below a given row in the tree (e.g. /employees/12/_ancestors lists the
+// employee's manager, the manager's manager, and so on).
+func (c *Controller) Tree(table string) {
+	tab := c.mod.GetTable(table)
+	tw, ok := tab.Driver.(bdog.TreeWalker)
+	if !ok {
+		return
+	}
+	rel, ok := tab.Relation("parent", c.mod.GetTable)
+	if !ok {
+		return
+	}
+	maxDepth := c.MaxTreeDepth
+	if maxDepth < 1 {
+		maxDepth = bdog.DefaultTreeDepth
+	}
+	keypath := ":" + strings.Join(tab.Key, "/:")
+
+	single := tab.SingleName(true)
+	for _, dir := range []struct {
+		name, position, description string
+		up                          bool
+	}{
+		{"_ancestors", "above", "Returns the parent of the " + single + ", the parent's parent, and so on", true},
+		{"_descendants", "below", "Returns the children of the " + single + ", their children, and so on", false},
+	} {
+		up := dir.up
+		route := "/" + tab.PluralName(false) + "/" + keypath + "/" + dir.name
+		log.Println("GET", route)
+		apiTree := c.apiSpec.NewHandler("GET", route)
+		apiTree.Summary = "List the " + tab.PluralName(true) + " " + dir.position + " a given " + single
+		apiTree.Description = dir.description + " (using " + strings.Join(rel.Columns, ", ") + "), nearest first. " +
+			"The number of levels away is returned in the _depth field of each result."
+		apiTree.Parameters = append(apiTree.Parameters, APIParameter{
+			Name:        "_depth",
+			In:          "query",
+			Description: fmt.Sprintf("Maximum number of levels to return (default=%d)", maxDepth),
+			Schema:      APISchemaType{Type: "integer", Default: maxDepth, Minimum: 1, Maximum: maxDepth},
+		})
+		apiTree.Parameters = append(apiTree.Parameters, paginationParameters(tab)[:2]...)
+		apiTree.Parameters = append(apiTree.Parameters, fieldsParameter(tab))
+
+		c.router.GET(route, func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+			if r.Method != http.MethodGet {
+				basicError(w, http.StatusMethodNotAllowed)
+				return
+			}
+			if c.CORSEnabled {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			}
+			w.Header().Set("Content-Type", "application/json")
+
+			key := make([]string, len(tab.Key))
+			keyOpts := make(map[string][]string)
+			for i, colname := range tab.Key {
+				key[i] = params.ByName(colname)
+				keyOpts[colname] = []string{key[i]}
+			}
+
+			uq := r.URL.Query()
+			depth := maxDepth
+			if d := uq.Get("_depth"); d != "" {
+				n, err := strconv.Atoi(d)
+				if err != nil || n < 1 || n > maxDepth {
+					detailedError(w, http.StatusBadRequest, fmt.Errorf("_depth must be between 1 and %d", maxDepth))
+					return
+				}
+				depth = n
+			}
+			opts := make(map[string][]string)
+			for _, name := range []string{"_page", "_perpage", "_fields"} {
+				if vals, ok := uq[name]; ok {
+					opts[name] = vals
+				}
+			}
+
+			_, err := tab.Driver.Get(tab, keyOpts)
+			var data []interface{}
+			if err == nil {
+				data, err = tw.Tree(tab, rel, up, key, depth, opts)
+			}
+			if err != nil {
+				log.Println(err)
+				if err == bdog.ErrNotFound {
+					basicError(w, http.StatusNotFound)
+					return
+				}
+				if errors.Is(err, bdog.ErrInvalidFilter) {
+					detailedError(w, http.StatusBadRequest, err)
+					return
+				}
+				basicError(w, http.StatusInternalServerError)
+				return
+			}
+
+			err = json.NewEncoder(w).Encode(data)
+			if err != nil {
+				log.Println(err)
+				basicError(w, http.StatusInternalServerError)
+				return
+			}
+		})
+	}
+}
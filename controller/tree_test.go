@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	// 7 and 8 manage each other, so only the depth limit stops the recursion
+	c := sqliteController(t, `CREATE TABLE employees (id INTEGER PRIMARY KEY, name TEXT, manager_id INTEGER REFERENCES employees(id));
+		INSERT INTO employees VALUES (1, 'Ada', NULL), (2, 'Bob', 1), (3, 'Cy', 2), (4, 'Di', 3), (5, 'Ed', 4),
+			(6, 'Flo', 1), (7, 'Gus', 8), (8, 'Hal', 7);`)
+	c.MaxTreeDepth = 5
+	h := c.GenerateRoutes("")
+
+	for _, tc := range []struct {
+		path   string
+		code   int
+		ids    []float64
+		depths []float64
+	}{
+		{"/employees/5/_ancestors?_depth=1", http.StatusOK, []float64{4}, []float64{1}},
+		{"/employees/5/_ancestors", http.StatusOK, []float64{4, 3, 2, 1}, []float64{1, 2, 3, 4}},
+		{"/employees/1/_ancestors", http.StatusOK, []float64{}, []float64{}},
+		{"/employees/1/_descendants?_depth=1", http.StatusOK, []float64{2, 6}, []float64{1, 1}},
+		{"/employees/1/_descendants", http.StatusOK, []float64{2, 6, 3, 4, 5}, []float64{1, 1, 2, 3, 4}},
+		{"/employees/1/_descendants?_depth=2&_perpage=2&_page=2", http.StatusOK, []float64{3}, []float64{2}},
+		{"/employees/7/_ancestors", http.StatusOK, []float64{8, 7, 8, 7, 8}, []float64{1, 2, 3, 4, 5}},
+		{"/employees/8/_descendants?_depth=2", http.StatusOK, []float64{7, 8}, []float64{1, 2}},
+		{"/employees/1/_descendants?_depth=0", http.StatusBadRequest, nil, nil},
+		{"/employees/1/_descendants?_depth=6", http.StatusBadRequest, nil, nil},
+		{"/employees/1/_descendants?_fields=nope", http.StatusBadRequest, nil, nil},
+		{"/employees/9/_ancestors", http.StatusNotFound, nil, nil},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if rec.Code != tc.code {
+			t.Errorf("%s: status = %d, want %d: %s", tc.path, rec.Code, tc.code, rec.Body.String())
+			continue
+		}
+		if tc.code != http.StatusOK {
+			continue
+		}
+		var rows []map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &rows); err != nil {
+			t.Fatal(err)
+		}
+		ids, depths := []float64{}, []float64{}
+		for _, row := range rows {
+			ids = append(ids, row["id"].(float64))
+			depths = append(depths, row["_depth"].(float64))
+		}
+		if !reflect.DeepEqual(ids, tc.ids) || !reflect.DeepEqual(depths, tc.depths) {
+			t.Errorf("%s = ids %v depths %v, want %v %v", tc.path, ids, depths, tc.ids, tc.depths)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/employees/5?include=parent", nil))
+	var row map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &row); err != nil {
+		t.Fatal(err)
+	}
+	if parent, _ := row["parent"].(map[string]interface{}); parent["id"] != 4.0 {
+		t.Errorf("include=parent = %v, want employee 4", row["parent"])
+	}
+
+	for path, want := range map[string][]float64{
+		"/employees/1/children":          {2, 6},
+		"/employees/5/children":          {},
+		"/employees/1?embed=children":    {2, 6},
+		"/employees?include=parent&id=3": {2},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status = %d: %s", path, rec.Code, rec.Body.String())
+			continue
+		}
+		var rows []map[string]interface{}
+		switch path {
+		case "/employees/1?embed=children":
+			var emb struct {
+				Children []map[string]interface{} `json:"children"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &emb); err != nil {
+				t.Fatal(err)
+			}
+			rows = emb.Children
+		case "/employees?include=parent&id=3":
+			if err := json.Unmarshal(rec.Body.Bytes(), &rows); err != nil {
+				t.Fatal(err)
+			}
+			for i, row := range rows {
+				rows[i], _ = row["parent"].(map[string]interface{})
+			}
+		default:
+			if err := json.Unmarshal(rec.Body.Bytes(), &rows); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ids := []float64{}
+		for _, row := range rows {
+			ids = append(ids, row["id"].(float64))
+		}
+		if !reflect.DeepEqual(ids, want) {
+			t.Errorf("%s = ids %v, want %v", path, ids, want)
+		}
+	}
+}
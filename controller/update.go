@@ -2,7 +2,6 @@ package controller
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
 	"strings"
@@ -22,7 +21,7 @@ func (c *Controller) Update(table string) {
 	apiPatch.Summary = "Update (part of) " + tab.SingleName(true) + " details"
 
 	c.router.PATCH(route, func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
-		if r.Method != http.MethodPut {
+		if r.Method != http.MethodPatch {
 			basicError(w, http.StatusMethodNotAllowed)
 			return
 		}
@@ -34,17 +33,19 @@ func (c *Controller) Update(table string) {
 		opts := make(map[string][]string)
 		if r.Header.Get("Content-Type") == "application/json" {
 			data := make(map[string]interface{})
-			err := json.NewDecoder(r.Body).Decode(&data)
+			dec := json.NewDecoder(r.Body)
+			// keep numbers in their original format, e.g. avoid 1e+06
+			dec.UseNumber()
+			err := dec.Decode(&data)
 			if err != nil {
 				log.Println(err)
 				basicError(w, http.StatusBadRequest)
 				return
 			}
-			for _, colname := range tab.Columns {
-				val, ok := data[colname]
-				if ok {
-					opts[colname] = append(opts[colname], fmt.Sprint(val))
-				}
+			if err = jsonOptions(tab, data, opts); err != nil {
+				log.Println(err)
+				detailedError(w, http.StatusBadRequest, err)
+				return
 			}
 		} else {
 			r.ParseForm()
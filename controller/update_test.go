@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	h := sqliteHandler(t, `CREATE TABLE widgets (id INTEGER PRIMARY KEY, name TEXT, qty INTEGER, active BOOLEAN);
+		INSERT INTO widgets VALUES (1, 'bolt', 5, 0), (2, 'nut', 3, 1);`)
+	for _, tc := range []struct {
+		method, path, contentType, body string
+		code                            int
+		want                            map[string]interface{}
+	}{
+		{http.MethodPatch, "/widgets/1", "application/json", `{"qty": 7, "active": true}`, http.StatusOK,
+			map[string]interface{}{"id": 1.0, "name": "bolt", "qty": 7.0, "active": true}},
+		{http.MethodPatch, "/widgets/2", "application/x-www-form-urlencoded", "name=washer&id=9", http.StatusOK,
+			map[string]interface{}{"id": 2.0, "name": "washer", "qty": 3.0, "active": true}},
+		{http.MethodPatch, "/widgets/2", "application/json", `{}`, http.StatusOK,
+			map[string]interface{}{"id": 2.0, "name": "washer", "qty": 3.0, "active": true}},
+		{http.MethodPatch, "/widgets/3", "application/json", `{"qty": 1}`, http.StatusNotFound, nil},
+		{http.MethodPut, "/widgets/1", "application/json", `{"qty": 1}`, http.StatusMethodNotAllowed, nil},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", tc.contentType)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.code {
+			t.Errorf("%s %s %s: status = %d, want %d: %s", tc.method, tc.path, tc.body, rec.Code, tc.code, rec.Body.String())
+			continue
+		}
+		if tc.want == nil {
+			continue
+		}
+		var got map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s %s %s = %v, want %v", tc.method, tc.path, tc.body, got, tc.want)
+		}
+	}
+}
@@ -2,18 +2,93 @@ package drivers
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"net/url"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/pbnjay/bdog"
+	"github.com/pbnjay/bdog/drivers/mysql"
+	"github.com/pbnjay/bdog/drivers/postgres"
 	"github.com/pbnjay/bdog/drivers/sqlite3"
 )
 
+var (
+	openersMu sync.RWMutex
+	openers   = make(map[string]func(dsn string) (bdog.Model, error))
+)
+
+func init() {
+	Register("postgres", postgres.Open)
+	Register("postgresql", postgres.Open)
+	Register("mysql", mysql.Open)
+	Register("mariadb", mysql.Open)
+	Register("sqlite", openSqlite)
+	Register("sqlite3", openSqlite)
+	Register("file", sqlite3.Open)
+}
+
+// Register makes a database driver available to Init for connection strings
+// using the given URL scheme (e.g. "postgres" for "postgres://..." URLs). It
+// is intended to be called from the init function of a driver package, so
+// that custom builds can link in additional drivers.
+//
+// As with database/sql, Register panics if it is called twice for the same
+// scheme or if opener is nil.
+func Register(scheme string, opener func(dsn string) (bdog.Model, error)) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+	if opener == nil {
+		panic("drivers: Register opener is nil")
+	}
+	scheme = strings.ToLower(scheme)
+	if _, dup := openers[scheme]; dup {
+		panic("drivers: Register called twice for scheme " + scheme)
+	}
+	openers[scheme] = opener
+}
+
+// Schemes returns a sorted list of the registered URL schemes.
+func Schemes() []string {
+	openersMu.RLock()
+	defer openersMu.RUnlock()
+	res := make([]string, 0, len(openers))
+	for scheme := range openers {
+		res = append(res, scheme)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Init opens and introspects the database described by dbName. URLs are
+// handled by the driver registered for their scheme, and anything else is
+// assumed to be the path to a sqlite database file.
 func Init(dbName string) (bdog.Model, error) {
 	uu, err := url.Parse(dbName)
-	if err == nil && uu.Scheme != "" {
-		log.Println("DB Scheme: ", uu.Scheme)
+	// single letter schemes are most likely windows drive letters
+	if err != nil || len(uu.Scheme) < 2 {
+		return openSqlite(dbName)
+	}
+
+	log.Println("DB Scheme: ", uu.Scheme)
+	openersMu.RLock()
+	opener, ok := openers[strings.ToLower(uu.Scheme)]
+	openersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("drivers: unknown scheme '%s' (registered schemes: %s)",
+			uu.Scheme, strings.Join(Schemes(), ", "))
+	}
+	return opener(dbName)
+}
+
+// openSqlite opens a sqlite database file, optionally given as a
+// sqlite://path or sqlite3://path URL.
+func openSqlite(dbName string) (bdog.Model, error) {
+	if i := strings.Index(dbName, "://"); i != -1 {
+		dbName = dbName[i+3:]
 	}
 
 	info, err := os.Stat(dbName)
@@ -0,0 +1,67 @@
+package drivers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pbnjay/bdog"
+)
+
+var errFake = errors.New("fake opener")
+
+func TestInit(t *testing.T) {
+	var opened string
+	Register("Fake-Test", func(dsn string) (bdog.Model, error) {
+		opened = dsn
+		return nil, errFake
+	})
+
+	if _, err := Init("FAKE-TEST://host/db"); err != errFake || opened != "FAKE-TEST://host/db" {
+		t.Errorf("Init with registered scheme = %v (opened %q), want fake opener", err, opened)
+	}
+
+	_, err := Init("oracle://host/db")
+	if err == nil || !strings.Contains(err.Error(), "unknown scheme 'oracle'") {
+		t.Fatalf("Init with unknown scheme = %v", err)
+	}
+	if !strings.Contains(err.Error(), strings.Join(Schemes(), ", ")) ||
+		!strings.Contains(err.Error(), "fake-test") || !strings.Contains(err.Error(), "postgres") {
+		t.Errorf("unknown scheme error does not list registered schemes: %v", err)
+	}
+
+	// single letter schemes are windows drive letters, opened as sqlite files
+	for _, name := range []string{`C:\no\such\file.db`, "c:/no/such/file.db"} {
+		if _, err := Init(name); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Init(%q) = %v, want file not found", name, err)
+		}
+	}
+
+	dir := t.TempDir()
+	if _, err := Init(dir); err == nil || !strings.Contains(err.Error(), "directory") {
+		t.Errorf("Init(directory) = %v, want directory error", err)
+	}
+	if _, err := Init("sqlite://" + filepath.Join(dir, "missing.db")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Init(sqlite URL) = %v, want file not found", err)
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	fake := func(string) (bdog.Model, error) { return nil, errFake }
+	for name, fn := range map[string]func(){
+		"duplicate":            func() { Register("postgres", fake) },
+		"duplicate mixed case": func() { Register("MySQL", fake) },
+		"nil opener":           func() { Register("nil-test", nil) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register %s did not panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
@@ -0,0 +1,269 @@
+package mysql
+
+import (
+	"database/sql"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pbnjay/bdog"
+)
+
+// Open connects to the MySQL/MariaDB database described by dsn (either a
+// mysql:// URL or a native user:pass@tcp(host:port)/dbname string) and
+// introspects the tables in the current database.
+//
+// NB the tree queries of bdog.SQLModel use WITH RECURSIVE, which requires
+// MySQL 8.0 or MariaDB 10.2 or newer.
+func Open(dsn string) (bdog.Model, error) {
+	dsn, err := nativeDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sql.Open("mysql", dsn)
+	if err == nil {
+		err = conn.Ping()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	/////
+	// step 1: list all tables
+	// step 2: list all columns in each table
+	// step 3: list all primary keys for each table
+	// step 4: list all foreign keys in each table
+
+	tabs := make(map[string]bdog.Table, 10)
+	/////
+	rows, err := conn.Query(schemaDumpSQL)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var tabName, colName, colType = "", "", ""
+	var notNull, autoInc bool
+	var pkOrder int
+	pkOrders := make(map[string]map[string]int)
+	for rows.Next() {
+		var defValue sql.NullString
+		err = rows.Scan(&tabName, &colName, &colType, &notNull, &defValue, &autoInc, &pkOrder)
+		if err != nil {
+			rows.Close()
+			conn.Close()
+			return nil, err
+		}
+		tab, found := tabs[tabName]
+		if !found {
+			tab.Name = tabName
+			tab.ColumnInfo = make(map[string]bdog.ColumnInfo)
+		}
+		tab.Columns = append(tab.Columns, colName)
+		tab.ColumnInfo[colName] = bdog.ColumnInfo{
+			SQLType:       colType,
+			Type:          bdog.NormalizeType(colType),
+			NotNull:       notNull,
+			Default:       defValue,
+			AutoIncrement: autoInc,
+		}
+		if pkOrder > 0 {
+			tab.Key = append(tab.Key, colName)
+			if pkOrders[tabName] == nil {
+				pkOrders[tabName] = make(map[string]int)
+			}
+			pkOrders[tabName][colName] = pkOrder
+		}
+
+		tabs[tabName] = tab
+	}
+	rows.Close()
+
+	// columns are listed in table order, but keys need to be in constraint order
+	for tabName, orders := range pkOrders {
+		tab := tabs[tabName]
+		sort.Slice(tab.Key, func(i, j int) bool {
+			return orders[tab.Key[i]] < orders[tab.Key[j]]
+		})
+		tabs[tabName] = tab
+	}
+
+	///
+	// check for any unique keys
+	rows, err = conn.Query(uniqueColsDumpSQL)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	for rows.Next() {
+		err := rows.Scan(&tabName, &colName)
+		if err != nil {
+			rows.Close()
+			conn.Close()
+			return nil, err
+		}
+		tab, found := tabs[tabName]
+		if !found {
+			continue
+		}
+		tab.UniqueColumns = append(tab.UniqueColumns, colName)
+		tabs[tabName] = tab
+	}
+	rows.Close()
+	///
+	rows, err = conn.Query(foreignKeyDumpSQL)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var otherTabName, otherColName = "", ""
+	fkID := ""
+	type fkinfo struct {
+		srcTable  string
+		destTable string
+		src       bdog.ColumnSet
+		dest      bdog.ColumnSet
+	}
+	fkData := make(map[string]*fkinfo, 5)
+
+	for rows.Next() {
+		err = rows.Scan(&fkID, &tabName, &colName, &otherTabName, &otherColName, &pkOrder)
+		if err != nil {
+			rows.Close()
+			conn.Close()
+			return nil, err
+		}
+
+		if pkOrder == 0 {
+			fki := &fkinfo{srcTable: tabName, destTable: otherTabName}
+			fkData[tabName+":"+fkID] = fki
+		}
+		fkData[tabName+":"+fkID].src = append(fkData[tabName+":"+fkID].src, colName)
+		fkData[tabName+":"+fkID].dest = append(fkData[tabName+":"+fkID].dest, otherColName)
+	}
+	rows.Close()
+
+	for _, fk := range fkData {
+		tab, found := tabs[fk.srcTable]
+		if !found {
+			log.Println(fk.srcTable)
+			panic("corrupted database schema")
+		}
+		otherTab, found := tabs[fk.destTable]
+		if !found {
+			// foreign key into another database, which we do not expose
+			log.Println("ignoring foreign key to", fk.destTable)
+			continue
+		}
+		if tab.Linked == nil {
+			tab.Linked = make(map[bdog.ColumnSetString]map[string][]bdog.ColumnSet)
+		}
+		if otherTab.RevLinked == nil {
+			otherTab.RevLinked = make(map[string]struct{})
+		}
+		fkcss := bdog.ColumnSetAsString(fk.src)
+		if _, ok := tab.Linked[fkcss]; !ok {
+			tab.Linked[fkcss] = make(map[string][]bdog.ColumnSet)
+		}
+		otherTab.RevLinked[fk.srcTable] = struct{}{}
+		tab.Linked[fkcss][fk.destTable] = append(tab.Linked[fkcss][fk.destTable], fk.dest)
+		if fk.srcTable == fk.destTable {
+			// self-referencing key, so both copies are the same table
+			tab.RevLinked = otherTab.RevLinked
+		}
+		tabs[fk.destTable] = otherTab
+		tabs[fk.srcTable] = tab
+	}
+
+	bdog.LinkJunctions(tabs)
+	return bdog.NewSQLModel(conn, dialect, tabs), nil
+}
+
+// lists every column of the base tables in the current database, along with
+// the column's position within the primary key (or 0 if not part of it).
+var schemaDumpSQL = `
+SELECT
+	c.TABLE_NAME,
+	c.COLUMN_NAME,
+	c.COLUMN_TYPE,
+	c.IS_NULLABLE = 'NO' AS not_null,
+	c.COLUMN_DEFAULT,
+	c.EXTRA LIKE '%auto_increment%',
+	COALESCE(k.ORDINAL_POSITION, 0) AS pk_order
+FROM
+	information_schema.COLUMNS AS c
+JOIN
+	information_schema.TABLES AS t
+	ON t.TABLE_SCHEMA = c.TABLE_SCHEMA AND t.TABLE_NAME = c.TABLE_NAME
+LEFT JOIN
+	information_schema.KEY_COLUMN_USAGE AS k
+	ON k.TABLE_SCHEMA = c.TABLE_SCHEMA
+	AND k.TABLE_NAME = c.TABLE_NAME
+	AND k.COLUMN_NAME = c.COLUMN_NAME
+	AND k.CONSTRAINT_NAME = 'PRIMARY'
+WHERE
+	c.TABLE_SCHEMA = DATABASE()
+	AND t.TABLE_TYPE = 'BASE TABLE'
+ORDER BY
+	c.TABLE_NAME,
+	c.ORDINAL_POSITION
+`
+
+// ORDINAL_POSITION is 1-based, so fk_seq starts at 0.
+var foreignKeyDumpSQL = `
+SELECT
+	k.CONSTRAINT_NAME,
+	k.TABLE_NAME,
+	k.COLUMN_NAME,
+	k.REFERENCED_TABLE_NAME,
+	k.REFERENCED_COLUMN_NAME,
+	k.ORDINAL_POSITION - 1 AS fk_seq
+FROM
+	information_schema.KEY_COLUMN_USAGE AS k
+WHERE
+	k.TABLE_SCHEMA = DATABASE()
+	AND k.REFERENCED_TABLE_SCHEMA = DATABASE()
+	AND k.REFERENCED_TABLE_NAME IS NOT NULL
+ORDER BY
+	k.TABLE_NAME,
+	k.CONSTRAINT_NAME,
+	k.ORDINAL_POSITION
+`
+
+// dumps ONLY UNIQUE indexes with exactly one column in the table.
+var uniqueColsDumpSQL = `
+SELECT s.TABLE_NAME, MAX(s.COLUMN_NAME)
+  FROM information_schema.STATISTICS AS s
+ WHERE s.TABLE_SCHEMA = DATABASE()
+   AND s.NON_UNIQUE = 0 AND s.INDEX_NAME <> 'PRIMARY'
+GROUP BY s.TABLE_NAME, s.INDEX_NAME
+HAVING COUNT(*) = 1
+`
+
+// nativeDSN converts a mysql:// or mariadb:// URL into the DSN format
+// expected by the go-sql-driver package. Other values are returned as-is.
+func nativeDSN(dsn string) (string, error) {
+	if !strings.HasPrefix(dsn, "mysql://") && !strings.HasPrefix(dsn, "mariadb://") {
+		return dsn, nil
+	}
+	uu, err := url.Parse(dsn)
+	if err != nil {
+		return "", err
+	}
+	cfg := mysql.NewConfig()
+	cfg.Net = "tcp"
+	cfg.Addr = uu.Host
+	cfg.DBName = strings.TrimPrefix(uu.Path, "/")
+	if uu.User != nil {
+		cfg.User = uu.User.Username()
+		cfg.Passwd, _ = uu.User.Password()
+	}
+	if len(uu.Query()) > 0 {
+		cfg.Params = make(map[string]string)
+		for k, v := range uu.Query() {
+			cfg.Params[k] = v[0]
+		}
+	}
+	return cfg.FormatDSN(), nil
+}
@@ -0,0 +1,25 @@
+package mysql
+
+import (
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/pbnjay/bdog"
+)
+
+const (
+	DefaultPerPage = bdog.DefaultPerPage
+	MaxPerPage     = bdog.MaxPerPage
+)
+
+// dialect uses unnumbered "?" placeholders. RETURNING and NULLS FIRST/LAST
+// are not available on most MySQL versions, and rows of default values are
+// inserted with empty column and VALUES lists.
+var dialect = bdog.Dialect{
+	Placeholder:   placeholder,
+	EmulateNulls:  true,
+	DefaultValues: "() VALUES ()",
+}
+
+// placeholder returns the query parameter placeholder for any argument.
+func placeholder(int) string {
+	return "?"
+}
@@ -0,0 +1,251 @@
+package postgres
+
+import (
+	"database/sql"
+	"log"
+	"sort"
+
+	_ "github.com/lib/pq"
+	"github.com/pbnjay/bdog"
+)
+
+// Open connects to the PostgreSQL database described by dsn (either a
+// postgres:// URL or a key=value connection string) and introspects the
+// tables in the current schema.
+func Open(dsn string) (bdog.Model, error) {
+	conn, err := sql.Open("postgres", dsn)
+	if err == nil {
+		err = conn.Ping()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	/////
+	// step 1: list all tables
+	// step 2: list all columns in each table
+	// step 3: list all primary keys for each table
+	// step 4: list all foreign keys in each table
+
+	tabs := make(map[string]bdog.Table, 10)
+	/////
+	rows, err := conn.Query(schemaDumpSQL)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var tabName, colName, colType = "", "", ""
+	var notNull, autoInc bool
+	var pkOrder int
+	pkOrders := make(map[string]map[string]int)
+	for rows.Next() {
+		var defValue sql.NullString
+		err = rows.Scan(&tabName, &colName, &colType, &notNull, &defValue, &autoInc, &pkOrder)
+		if err != nil {
+			rows.Close()
+			conn.Close()
+			return nil, err
+		}
+		tab, found := tabs[tabName]
+		if !found {
+			tab.Name = tabName
+			tab.ColumnInfo = make(map[string]bdog.ColumnInfo)
+		}
+		tab.Columns = append(tab.Columns, colName)
+		tab.ColumnInfo[colName] = bdog.ColumnInfo{
+			SQLType:       colType,
+			Type:          bdog.NormalizeType(colType),
+			NotNull:       notNull,
+			Default:       defValue,
+			AutoIncrement: autoInc,
+		}
+		if pkOrder > 0 {
+			tab.Key = append(tab.Key, colName)
+			if pkOrders[tabName] == nil {
+				pkOrders[tabName] = make(map[string]int)
+			}
+			pkOrders[tabName][colName] = pkOrder
+		}
+
+		tabs[tabName] = tab
+	}
+	rows.Close()
+
+	// columns are listed in table order, but keys need to be in constraint order
+	for tabName, orders := range pkOrders {
+		tab := tabs[tabName]
+		sort.Slice(tab.Key, func(i, j int) bool {
+			return orders[tab.Key[i]] < orders[tab.Key[j]]
+		})
+		tabs[tabName] = tab
+	}
+
+	///
+	// check for any unique keys
+	rows, err = conn.Query(uniqueColsDumpSQL)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	for rows.Next() {
+		err := rows.Scan(&tabName, &colName)
+		if err != nil {
+			rows.Close()
+			conn.Close()
+			return nil, err
+		}
+		tab, found := tabs[tabName]
+		if !found {
+			continue
+		}
+		tab.UniqueColumns = append(tab.UniqueColumns, colName)
+		tabs[tabName] = tab
+	}
+	rows.Close()
+	///
+	rows, err = conn.Query(foreignKeyDumpSQL)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var otherTabName, otherColName = "", ""
+	fkID := ""
+	type fkinfo struct {
+		srcTable  string
+		destTable string
+		src       bdog.ColumnSet
+		dest      bdog.ColumnSet
+	}
+	fkData := make(map[string]*fkinfo, 5)
+
+	for rows.Next() {
+		err = rows.Scan(&fkID, &tabName, &colName, &otherTabName, &otherColName, &pkOrder)
+		if err != nil {
+			rows.Close()
+			conn.Close()
+			return nil, err
+		}
+
+		if pkOrder == 0 {
+			fki := &fkinfo{srcTable: tabName, destTable: otherTabName}
+			fkData[tabName+":"+fkID] = fki
+		}
+		fkData[tabName+":"+fkID].src = append(fkData[tabName+":"+fkID].src, colName)
+		fkData[tabName+":"+fkID].dest = append(fkData[tabName+":"+fkID].dest, otherColName)
+	}
+	rows.Close()
+
+	for _, fk := range fkData {
+		tab, found := tabs[fk.srcTable]
+		if !found {
+			log.Println(fk.srcTable)
+			panic("corrupted database schema")
+		}
+		otherTab, found := tabs[fk.destTable]
+		if !found {
+			// foreign key into another schema, which we do not expose
+			log.Println("ignoring foreign key to", fk.destTable)
+			continue
+		}
+		if tab.Linked == nil {
+			tab.Linked = make(map[bdog.ColumnSetString]map[string][]bdog.ColumnSet)
+		}
+		if otherTab.RevLinked == nil {
+			otherTab.RevLinked = make(map[string]struct{})
+		}
+		fkcss := bdog.ColumnSetAsString(fk.src)
+		if _, ok := tab.Linked[fkcss]; !ok {
+			tab.Linked[fkcss] = make(map[string][]bdog.ColumnSet)
+		}
+		otherTab.RevLinked[fk.srcTable] = struct{}{}
+		tab.Linked[fkcss][fk.destTable] = append(tab.Linked[fkcss][fk.destTable], fk.dest)
+		if fk.srcTable == fk.destTable {
+			// self-referencing key, so both copies are the same table
+			tab.RevLinked = otherTab.RevLinked
+		}
+		tabs[fk.destTable] = otherTab
+		tabs[fk.srcTable] = tab
+	}
+
+	bdog.LinkJunctions(tabs)
+	return bdog.NewSQLModel(conn, dialect, tabs), nil
+}
+
+// lists every column of the base tables in the current schema, along with
+// the column's position within the primary key (or 0 if not part of it).
+var schemaDumpSQL = `
+SELECT
+	c.table_name,
+	c.column_name,
+	CASE WHEN c.data_type = 'USER-DEFINED' THEN c.udt_name ELSE c.data_type END,
+	c.is_nullable = 'NO' AS not_null,
+	c.column_default,
+	COALESCE(c.column_default LIKE 'nextval(%', false) OR c.is_identity = 'YES',
+	COALESCE(k.ordinal_position, 0) AS pk_order
+FROM
+	information_schema.columns AS c
+JOIN
+	information_schema.tables AS t
+	ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+LEFT JOIN (
+	SELECT kcu.table_name, kcu.column_name, kcu.ordinal_position
+	FROM information_schema.table_constraints AS tc
+	JOIN information_schema.key_column_usage AS kcu
+		ON kcu.constraint_schema = tc.constraint_schema
+		AND kcu.constraint_name = tc.constraint_name
+		AND kcu.table_name = tc.table_name
+	WHERE tc.constraint_type = 'PRIMARY KEY'
+		AND tc.table_schema = current_schema()
+) AS k
+	ON k.table_name = c.table_name AND k.column_name = c.column_name
+WHERE
+	c.table_schema = current_schema()
+	AND t.table_type = 'BASE TABLE'
+ORDER BY
+	c.table_name,
+	c.ordinal_position
+`
+
+// the foreign key column pairs are unnested in constraint order, fk_seq starts at 0.
+var foreignKeyDumpSQL = `
+SELECT
+	c.conname,
+	t.relname AS table_name,
+	a.attname AS column_name,
+	ft.relname AS fk_table,
+	fa.attname AS fk_column,
+	k.ord - 1 AS fk_seq
+FROM
+	pg_catalog.pg_constraint AS c
+JOIN
+	pg_catalog.pg_class AS t ON t.oid = c.conrelid
+JOIN
+	pg_catalog.pg_namespace AS n ON n.oid = t.relnamespace
+JOIN
+	pg_catalog.pg_class AS ft ON ft.oid = c.confrelid
+CROSS JOIN
+	unnest(c.conkey, c.confkey) WITH ORDINALITY AS k(attnum, fattnum, ord)
+JOIN
+	pg_catalog.pg_attribute AS a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+JOIN
+	pg_catalog.pg_attribute AS fa ON fa.attrelid = c.confrelid AND fa.attnum = k.fattnum
+WHERE
+	c.contype = 'f'
+	AND n.nspname = current_schema()
+ORDER BY
+	t.relname,
+	c.conname,
+	k.ord
+`
+
+// dumps ONLY UNIQUE indexes with exactly one column in the table.
+var uniqueColsDumpSQL = `
+SELECT t.relname, a.attname
+  FROM pg_catalog.pg_index AS i
+  JOIN pg_catalog.pg_class AS t ON t.oid = i.indrelid
+  JOIN pg_catalog.pg_namespace AS n ON n.oid = t.relnamespace
+  JOIN pg_catalog.pg_attribute AS a ON a.attrelid = t.oid AND a.attnum = i.indkey[0]
+ WHERE i.indisunique AND NOT i.indisprimary
+   AND i.indnatts = 1 AND i.indpred IS NULL
+   AND n.nspname = current_schema()
+`
@@ -0,0 +1,25 @@
+package postgres
+
+import (
+	"fmt"
+
+	_ "github.com/lib/pq"
+	"github.com/pbnjay/bdog"
+)
+
+const (
+	DefaultPerPage = bdog.DefaultPerPage
+	MaxPerPage     = bdog.MaxPerPage
+)
+
+// dialect uses numbered "$N" placeholders.
+var dialect = bdog.Dialect{
+	Placeholder:   placeholder,
+	Returning:     true,
+	DefaultValues: "DEFAULT VALUES",
+}
+
+// placeholder returns the query parameter placeholder for the n-th argument.
+func placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
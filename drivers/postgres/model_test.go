@@ -0,0 +1,26 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/pbnjay/bdog"
+)
+
+func TestDialect(t *testing.T) {
+	for n, want := range map[int]string{1: "$1", 2: "$2", 12: "$12"} {
+		if got := dialect.Placeholder(n); got != want {
+			t.Errorf("Placeholder(%d) = %q, want %q", n, got, want)
+		}
+	}
+	if !dialect.Returning {
+		t.Error("Returning = false, want true")
+	}
+	if dialect.DefaultValues != "DEFAULT VALUES" {
+		t.Errorf("DefaultValues = %q", dialect.DefaultValues)
+	}
+
+	fields := []bdog.SortField{{Column: "elevation_ft", Desc: true, Nulls: "last"}, {Column: "ident"}}
+	if got, want := bdog.OrderByClause(fields, dialect.EmulateNulls), "elevation_ft DESC NULLS LAST, ident"; got != want {
+		t.Errorf("OrderByClause = %q, want %q", got, want)
+	}
+}
@@ -3,6 +3,8 @@ package sqlite3
 import (
 	"database/sql"
 	"log"
+	"regexp"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pbnjay/bdog"
@@ -23,37 +25,70 @@ func Open(dbName string) (bdog.Model, error) {
 	// step 3: list all primary keys for each table
 	// step 4: list all foreign keys in each table
 
-	mod := &sModel{conn: conn, tabs: make(map[string]bdog.Table, 10)}
+	tabs := make(map[string]bdog.Table, 10)
+
+	// virtual tables (and their shadow tables) are not exposed, but FTS5
+	// tables are used to search the tables they index
+	ftsIndexes, hidden, err := listVirtualTables(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
 	/////
 	rows, err := conn.Query(schemaDumpSQL)
 	if err != nil {
 		conn.Close()
 		return nil, err
 	}
-	var tabName, colName = "", ""
+	var tabName, colName, colType = "", "", ""
 	var notNull bool
 	var pkOrder int
 	for rows.Next() {
-		err = rows.Scan(&tabName, &colName, &notNull, &pkOrder)
+		var defValue sql.NullString
+		err = rows.Scan(&tabName, &colName, &colType, &notNull, &defValue, &pkOrder)
 		if err != nil {
 			rows.Close()
 			conn.Close()
 			return nil, err
 		}
-		tab, found := mod.tabs[tabName]
+		if _, skip := hidden[tabName]; skip {
+			continue
+		}
+		tab, found := tabs[tabName]
 		if !found {
 			tab.Name = tabName
+			tab.ColumnInfo = make(map[string]bdog.ColumnInfo)
 		}
 		tab.Columns = append(tab.Columns, colName)
 		if pkOrder > 0 {
 			tab.Key = append(tab.Key, colName)
 		}
+		tab.ColumnInfo[colName] = bdog.ColumnInfo{
+			SQLType: colType,
+			Type:    bdog.NormalizeType(colType),
+			NotNull: notNull,
+			Default: defValue,
+		}
 
-		mod.tabs[tabName] = tab
+		tabs[tabName] = tab
 		//log.Println(tabName, colName, notNull, pkOrder)
 	}
 	rows.Close()
 
+	// a single "INTEGER PRIMARY KEY" column is an alias for the rowid,
+	// see https://www.sqlite.org/lang_createtable.html#rowid
+	for _, tab := range tabs {
+		if len(tab.Key) != 1 {
+			continue
+		}
+		ci := tab.ColumnInfo[tab.Key[0]]
+		if strings.EqualFold(ci.SQLType, "INTEGER") {
+			ci.AutoIncrement = true
+			tab.ColumnInfo[tab.Key[0]] = ci
+		}
+	}
+
 	///
 	// check for any unique keys
 	rows, err = conn.Query(uniqueColsDumpSQL)
@@ -67,9 +102,12 @@ func Open(dbName string) (bdog.Model, error) {
 			rows.Close()
 			return nil, err
 		}
-		tab := mod.tabs[tabName]
+		if _, skip := hidden[tabName]; skip {
+			continue
+		}
+		tab := tabs[tabName]
 		tab.UniqueColumns = append(tab.UniqueColumns, colName)
-		mod.tabs[tabName] = tab
+		tabs[tabName] = tab
 	}
 	rows.Close()
 	///
@@ -95,6 +133,9 @@ func Open(dbName string) (bdog.Model, error) {
 			conn.Close()
 			return nil, err
 		}
+		if _, skip := hidden[tabName]; skip {
+			continue
+		}
 
 		if pkOrder == 0 {
 			fki := &fkinfo{srcTable: tabName, destTable: otherTabName}
@@ -108,12 +149,12 @@ func Open(dbName string) (bdog.Model, error) {
 	rows.Close()
 
 	for _, fk := range fkData {
-		tab, found := mod.tabs[fk.srcTable]
+		tab, found := tabs[fk.srcTable]
 		if !found {
 			log.Println(tabName)
 			panic("corrupted database schema")
 		}
-		otherTab, found := mod.tabs[fk.destTable]
+		otherTab, found := tabs[fk.destTable]
 		if !found {
 			log.Println(fk.destTable)
 			panic("corrupted database schema")
@@ -130,23 +171,118 @@ func Open(dbName string) (bdog.Model, error) {
 		}
 		otherTab.RevLinked[fk.srcTable] = struct{}{}
 		tab.Linked[fkcss][fk.destTable] = append(tab.Linked[fkcss][fk.destTable], fk.dest)
-		mod.tabs[fk.srcTable] = tab
-		mod.tabs[fk.destTable] = otherTab
+		if fk.srcTable == fk.destTable {
+			// self-referencing key, so both copies are the same table
+			tab.RevLinked = otherTab.RevLinked
+		}
+		tabs[fk.destTable] = otherTab
+		tabs[fk.srcTable] = tab
 	}
 
-	return mod, nil
+	for _, fts := range ftsIndexes {
+		tab, found := tabs[fts.content]
+		if !found {
+			continue
+		}
+		tab.FullTextIndex = fts.name
+		tab.FullTextRowID = fts.contentRowID
+		tabs[fts.content] = tab
+	}
+
+	bdog.LinkJunctions(tabs)
+	return bdog.NewSQLModel(conn, dialect, tabs), nil
 }
 
+type ftsIndex struct {
+	name         string
+	content      string
+	contentRowID string
+}
+
+var (
+	ftsModuleRegexp = regexp.MustCompile(`(?is)\bUSING\s+fts5\s*\((.*)\)`)
+	ftsOptionRegexp = regexp.MustCompile(`(?is)^\s*(content|content_rowid)\s*=\s*(.*?)\s*$`)
+
+	// suffixes of the shadow tables created for each full-text index, see
+	// https://www.sqlite.org/fts5.html and https://www.sqlite.org/fts3.html
+	ftsShadowSuffixes = []string{"_data", "_idx", "_content", "_docsize", "_config",
+		"_segments", "_segdir", "_stat"}
+)
+
+// listVirtualTables finds the FTS5 tables created using an external content=
+// table, along with the names of all virtual tables and their shadow tables.
+// If FTS5 support is not compiled in, no indexes are returned.
+func listVirtualTables(conn *sql.DB) ([]ftsIndex, map[string]struct{}, error) {
+	hasFTS5 := false
+	err := conn.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&hasFTS5)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := conn.Query(virtualTablesSQL)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var res []ftsIndex
+	hidden := make(map[string]struct{})
+	for rows.Next() {
+		var name, createSQL string
+		err = rows.Scan(&name, &createSQL)
+		if err != nil {
+			return nil, nil, err
+		}
+		hidden[name] = struct{}{}
+		for _, suffix := range ftsShadowSuffixes {
+			hidden[name+suffix] = struct{}{}
+		}
+
+		m := ftsModuleRegexp.FindStringSubmatch(createSQL)
+		if m == nil || !hasFTS5 {
+			continue
+		}
+		fts := ftsIndex{name: name, contentRowID: "rowid"}
+		for _, arg := range strings.Split(m[1], ",") {
+			opt := ftsOptionRegexp.FindStringSubmatch(arg)
+			if opt == nil {
+				continue
+			}
+			val := strings.Trim(opt[2], "'\"`[]")
+			if strings.EqualFold(opt[1], "content") {
+				fts.content = val
+			} else {
+				fts.contentRowID = val
+			}
+		}
+		// contentless and self-contained indexes can't be mapped to a table
+		if fts.content != "" {
+			res = append(res, fts)
+		}
+	}
+	return res, hidden, rows.Err()
+}
+
+var virtualTablesSQL = `
+SELECT name, sql
+  FROM sqlite_master
+ WHERE type='table' AND sql LIKE 'CREATE VIRTUAL TABLE%'
+`
+
 var schemaDumpSQL = `
 SELECT 
 	m.name as table_name, 
 	p.name as column_name,
+	p.type as column_type,
 	p."notnull" as null_allowed,
+	p.dflt_value as default_value,
 	p.pk as pk_order
 FROM 
 	sqlite_master AS m
 JOIN 
 	pragma_table_info(m.name) AS p
+WHERE
+	m.sql NOT LIKE 'CREATE VIRTUAL TABLE%'
 ORDER BY 
 	m.name, 
 	p.cid
@@ -164,6 +300,8 @@ FROM
   sqlite_master AS m
 JOIN 
   pragma_foreign_key_list(m.name) AS f
+WHERE
+  m.sql NOT LIKE 'CREATE VIRTUAL TABLE%'
 ORDER BY 
   m.name, 
   f.id
@@ -176,6 +314,7 @@ SELECT m.name, MAX(x.name)
   JOIN pragma_index_list(m.name) AS i
   JOIN pragma_index_info(i.name) AS x
  WHERE i.origin='u' AND i."unique"=1
+   AND m.sql NOT LIKE 'CREATE VIRTUAL TABLE%'
 GROUP BY m.name, i.name
 HAVING MAX(x.seqno)=0
 `
@@ -0,0 +1,48 @@
+-- A small schema using multi-column primary and foreign keys,
+-- for checking that related listings match on every key column.
+--
+-- Load it into a sqlite database and run the API with:
+--   sqlite3 courses.sqlite < composite_keys_schema.sql
+--   ./webapi courses.sqlite
+--
+-- Courses CS 101 and MATH 101 share a course number, so
+-- /courses/CS/101/sections must only list the CS sections, and
+-- /courses/MATH/101/sections only the MATH section.
+
+CREATE TABLE IF NOT EXISTS "departments"(
+  "code" TEXT PRIMARY KEY,
+  "name" TEXT UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS "courses"(
+  "dept" TEXT REFERENCES "departments" ("code"),
+  "number" INTEGER,
+  "title" TEXT,
+  PRIMARY KEY ("dept", "number")
+);
+
+CREATE TABLE IF NOT EXISTS "sections"(
+  "dept" TEXT,
+  "course_number" INTEGER,
+  "term" TEXT,
+  "section" INTEGER,
+  "instructor" TEXT,
+  PRIMARY KEY ("dept", "course_number", "term", "section"),
+  FOREIGN KEY ("dept", "course_number") REFERENCES "courses" ("dept", "number")
+);
+
+INSERT INTO "departments" VALUES
+  ('CS', 'Computer Science'),
+  ('MATH', 'Mathematics');
+
+INSERT INTO "courses" VALUES
+  ('CS', 101, 'Introduction to Programming'),
+  ('CS', 201, 'Data Structures'),
+  ('MATH', 101, 'Calculus I');
+
+INSERT INTO "sections" VALUES
+  ('CS', 101, '2023FA', 1, 'Hopper'),
+  ('CS', 101, '2023FA', 2, 'Lovelace'),
+  ('CS', 101, '2024SP', 1, 'Hopper'),
+  ('CS', 201, '2024SP', 1, 'Knuth'),
+  ('MATH', 101, '2023FA', 1, 'Noether');
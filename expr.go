@@ -0,0 +1,364 @@
+package bdog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FilterSyntaxError describes a problem parsing a filter expression.
+// It wraps ErrInvalidFilter, so can be checked using errors.Is.
+type FilterSyntaxError struct {
+	// Pos is the 1-based character position of the offending token,
+	// or -1 if the end of the expression was reached unexpectedly.
+	Pos int
+	// Token is the offending token.
+	Token string
+	// Msg describes the problem.
+	Msg string
+}
+
+func (e *FilterSyntaxError) Error() string {
+	if e.Pos < 1 {
+		return fmt.Sprintf("%s: %s at end of expression", ErrInvalidFilter, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s at position %d near '%s'", ErrInvalidFilter, e.Msg, e.Pos, e.Token)
+}
+
+func (e *FilterSyntaxError) Unwrap() error {
+	return ErrInvalidFilter
+}
+
+// MaxExprDepth is the maximum nesting of parentheses and NOT operators in a
+// filter expression.
+const MaxExprDepth = 32
+
+// ExprClause compiles a boolean filter expression into a parameterized SQL
+// condition for the table, returning the condition and the arguments it uses.
+// Placeholders are numbered as in FilterClause.
+//
+// Expressions combine comparisons using AND, OR, NOT and parentheses, e.g.
+//
+//	iso_country=US AND (type=large_airport OR scheduled_service=yes)
+//
+// Comparisons are "column op value", where op is one of =, !=, <>, <, <=, >,
+// >=, or any of the FilterOperators names (e.g. "elevation_ft gte 5000").
+// The in/nin operators take a parenthesized list of values, and null checks
+// are written as "column IS NULL" or "column IS NOT NULL". Values containing
+// spaces or symbols, or the words AND, OR and NOT, must be quoted with single
+// or double quotes. Values are converted using FilterArg. Expressions nested
+// more than MaxExprDepth levels deep are rejected.
+func (t *Table) ExprClause(expr string, nargs int, placeholder func(n int) string) (string, []interface{}, error) {
+	toks, err := tokenizeExpr(expr)
+	if err != nil {
+		return "", nil, err
+	}
+	p := &exprParser{
+		tab:   t,
+		toks:  toks,
+		nargs: nargs,
+		ph:    placeholder,
+	}
+	sql, err := p.parseOr()
+	if err != nil {
+		return "", nil, err
+	}
+	if p.pos < len(p.toks) {
+		return "", nil, p.errorf("unexpected token")
+	}
+	return sql, p.args, nil
+}
+
+type exprTokenKind int
+
+const (
+	tokWord exprTokenKind = iota
+	tokString
+	tokSymbol
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string
+	pos  int
+}
+
+// keyword returns the uppercase token text if it is an unquoted word.
+func (k exprToken) keyword() string {
+	if k.kind != tokWord {
+		return ""
+	}
+	return strings.ToUpper(k.text)
+}
+
+func tokenizeExpr(s string) ([]exprToken, error) {
+	var toks []exprToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '(' || c == ')' || c == ',':
+			toks = append(toks, exprToken{tokSymbol, s[i : i+1], i + 1})
+			i++
+
+		case c == '=' || c == '<' || c == '>' || c == '!':
+			j := i + 1
+			if j < len(s) && (s[j] == '=' || (c == '<' && s[j] == '>')) {
+				j++
+			}
+			if s[i:j] == "!" {
+				return nil, &FilterSyntaxError{Pos: i + 1, Token: "!", Msg: "unknown operator"}
+			}
+			toks = append(toks, exprToken{tokSymbol, s[i:j], i + 1})
+			i = j
+
+		case c == '\'' || c == '"':
+			// quotes are escaped by doubling them, as in SQL
+			var sb strings.Builder
+			j := i + 1
+			for {
+				if j >= len(s) {
+					return nil, &FilterSyntaxError{Pos: i + 1, Token: s[i:], Msg: "unterminated quoted string"}
+				}
+				if s[j] == c {
+					if j+1 < len(s) && s[j+1] == c {
+						sb.WriteByte(c)
+						j += 2
+						continue
+					}
+					break
+				}
+				sb.WriteByte(s[j])
+				j++
+			}
+			toks = append(toks, exprToken{tokString, sb.String(), i + 1})
+			i = j + 1
+
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t\r\n()=<>!,'\"", rune(s[j])) {
+				j++
+			}
+			toks = append(toks, exprToken{tokWord, s[i:j], i + 1})
+			i = j
+		}
+	}
+	return toks, nil
+}
+
+type exprParser struct {
+	tab   *Table
+	toks  []exprToken
+	pos   int
+	nargs int
+	ph    func(n int) string
+	args  []interface{}
+	depth int
+}
+
+func (p *exprParser) errorf(msg string, args ...interface{}) error {
+	if p.pos >= len(p.toks) {
+		return &FilterSyntaxError{Pos: -1, Msg: fmt.Sprintf(msg, args...)}
+	}
+	tok := p.toks[p.pos]
+	return &FilterSyntaxError{Pos: tok.pos, Token: tok.text, Msg: fmt.Sprintf(msg, args...)}
+}
+
+func (p *exprParser) peek() (exprToken, bool) {
+	if p.pos >= len(p.toks) {
+		return exprToken{}, false
+	}
+	return p.toks[p.pos], true
+}
+
+func (p *exprParser) isSymbol(sym string) bool {
+	tok, ok := p.peek()
+	return ok && tok.kind == tokSymbol && tok.text == sym
+}
+
+func (p *exprParser) isKeyword(kw string) bool {
+	tok, ok := p.peek()
+	return ok && tok.keyword() == kw
+}
+
+// arg adds a query argument for a value compared to col (converted using
+// Table.FilterArg) and returns its placeholder.
+func (p *exprParser) arg(col, val string) string {
+	p.args = append(p.args, p.tab.FilterArg(col, val))
+	return p.ph(p.nargs + len(p.args))
+}
+
+func (p *exprParser) parseOr() (string, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return "", err
+	}
+	for p.isKeyword("OR") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " OR " + right + ")"
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (string, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return "", err
+	}
+	for p.isKeyword("AND") {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " AND " + right + ")"
+	}
+	return left, nil
+}
+
+// nest checks that another level of nesting is allowed, and returns a
+// function to leave it again.
+func (p *exprParser) nest() (func(), error) {
+	if p.depth >= MaxExprDepth {
+		return nil, p.errorf("expression is nested more than %d levels deep", MaxExprDepth)
+	}
+	p.depth++
+	return func() { p.depth-- }, nil
+}
+
+func (p *exprParser) parseNot() (string, error) {
+	if p.isKeyword("NOT") {
+		leave, err := p.nest()
+		if err != nil {
+			return "", err
+		}
+		defer leave()
+		p.pos++
+		inner, err := p.parseNot()
+		if err != nil {
+			return "", err
+		}
+		return "(NOT " + inner + ")", nil
+	}
+	if p.isSymbol("(") {
+		leave, err := p.nest()
+		if err != nil {
+			return "", err
+		}
+		defer leave()
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return "", err
+		}
+		if !p.isSymbol(")") {
+			return "", p.errorf("expected ')'")
+		}
+		p.pos++
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+var exprSymbolOps = map[string]string{
+	"=":  "eq",
+	"==": "eq",
+	"!=": "ne",
+	"<>": "ne",
+	"<":  "lt",
+	"<=": "lte",
+	">":  "gt",
+	">=": "gte",
+}
+
+func (p *exprParser) parseComparison() (string, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return "", p.errorf("expected column name")
+	}
+	if tok.kind != tokWord {
+		return "", p.errorf("expected column name")
+	}
+	if !p.tab.HasColumn(tok.text) {
+		return "", p.errorf("unknown column")
+	}
+	col := tok.text
+	p.pos++
+
+	tok, ok = p.peek()
+	if !ok {
+		return "", p.errorf("expected operator")
+	}
+	op := ""
+	switch {
+	case tok.kind == tokSymbol:
+		op = exprSymbolOps[tok.text]
+	case tok.keyword() == "IS":
+		p.pos++
+		not := ""
+		if p.isKeyword("NOT") {
+			p.pos++
+			not = "NOT "
+		}
+		if !p.isKeyword("NULL") {
+			return "", p.errorf("expected NULL")
+		}
+		p.pos++
+		return col + " IS " + not + "NULL", nil
+	case tok.kind == tokWord:
+		op = strings.ToLower(tok.text)
+	}
+	sqlop, ok := filterSQL[op]
+	if !ok {
+		return "", p.errorf("unknown operator")
+	}
+	p.pos++
+
+	if op == "in" || op == "nin" {
+		if !p.isSymbol("(") {
+			return "", p.errorf("expected '(' to start list of values")
+		}
+		p.pos++
+		var phs []string
+		for {
+			val, err := p.parseValue()
+			if err != nil {
+				return "", err
+			}
+			phs = append(phs, p.arg(col, val))
+			if p.isSymbol(")") {
+				p.pos++
+				break
+			}
+			if !p.isSymbol(",") {
+				return "", p.errorf("expected ',' or ')'")
+			}
+			p.pos++
+		}
+		return fmt.Sprintf("%s %s (%s)", col, sqlop, strings.Join(phs, ",")), nil
+	}
+
+	val, err := p.parseValue()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s %s", col, sqlop, p.arg(col, val)), nil
+}
+
+func (p *exprParser) parseValue() (string, error) {
+	tok, ok := p.peek()
+	if !ok || tok.kind == tokSymbol {
+		return "", p.errorf("expected value")
+	}
+	switch tok.keyword() {
+	case "AND", "OR", "NOT":
+		return "", p.errorf("expected value (quote it to use the word %s)", tok.text)
+	}
+	p.pos++
+	return tok.text, nil
+}
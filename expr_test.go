@@ -0,0 +1,110 @@
+package bdog
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExprClauseKeywordValues(t *testing.T) {
+	tab := Table{Name: "airports", Columns: ColumnSet{"type", "name"}}
+	placeholder := func(n int) string { return fmt.Sprintf("$%d", n) }
+
+	for _, tc := range []struct {
+		expr string
+		pos  int
+	}{
+		{"type= AND", 7},
+		{"type=or", 6},
+		{"type=large AND name=NOT", 21},
+		{"type in (large, and)", 17},
+	} {
+		_, _, err := tab.ExprClause(tc.expr, 0, placeholder)
+		var se *FilterSyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("%q: got error %v, want a FilterSyntaxError", tc.expr, err)
+			continue
+		}
+		if se.Pos != tc.pos {
+			t.Errorf("%q: error at %d (%s), want %d", tc.expr, se.Pos, se, tc.pos)
+		}
+	}
+
+	sql, args, err := tab.ExprClause(`type='AND' OR name="not"`, 0, placeholder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sql != "(type = $1 OR name = $2)" || len(args) != 2 || args[0] != "AND" || args[1] != "not" {
+		t.Errorf("quoted keywords = %q %q", sql, args)
+	}
+}
+
+func TestExprClause(t *testing.T) {
+	tab := Table{Name: "airports", Columns: ColumnSet{"type", "name", "elevation_ft", "iso_country"}}
+	placeholder := func(n int) string { return fmt.Sprintf("$%d", n) }
+
+	for _, tc := range []struct {
+		expr string
+		sql  string
+		args []interface{}
+	}{
+		{"type=small", "type = $1", []interface{}{"small"}},
+		{"elevation_ft >= 5000", "elevation_ft >= $1", []interface{}{"5000"}},
+		{"elevation_ft gte 5000", "elevation_ft >= $1", []interface{}{"5000"}},
+		{"type=a OR type=b AND name=c", "(type = $1 OR (type = $2 AND name = $3))", []interface{}{"a", "b", "c"}},
+		{"type=a AND type=b OR name=c", "((type = $1 AND type = $2) OR name = $3)", []interface{}{"a", "b", "c"}},
+		{"(type=a OR type=b) AND name=c", "((type = $1 OR type = $2) AND name = $3)", []interface{}{"a", "b", "c"}},
+		{"NOT type=a AND name=c", "((NOT type = $1) AND name = $2)", []interface{}{"a", "c"}},
+		{"NOT (type=a OR name=c)", "(NOT (type = $1 OR name = $2))", []interface{}{"a", "c"}},
+		{"not not type!=a", "(NOT (NOT type <> $1))", []interface{}{"a"}},
+		{"type in (a, 'b c')", "type IN ($1,$2)", []interface{}{"a", "b c"}},
+		{"iso_country nin (US) AND type=x", "(iso_country NOT IN ($1) AND type = $2)", []interface{}{"US", "x"}},
+		{"name IS NULL", "name IS NULL", nil},
+		{"name is not null OR type=x", "(name IS NOT NULL OR type = $1)", []interface{}{"x"}},
+	} {
+		sql, args, err := tab.ExprClause(tc.expr, 0, placeholder)
+		if err != nil {
+			t.Errorf("%q: %v", tc.expr, err)
+			continue
+		}
+		if sql != tc.sql || !reflect.DeepEqual(args, tc.args) {
+			t.Errorf("%q = %q %q, want %q %q", tc.expr, sql, args, tc.sql, tc.args)
+		}
+	}
+
+	nested := strings.Repeat("(", MaxExprDepth) + "type=a" + strings.Repeat(")", MaxExprDepth)
+	if _, _, err := tab.ExprClause(nested, 0, placeholder); err != nil {
+		t.Errorf("%d levels: %v", MaxExprDepth, err)
+	}
+	for _, tc := range []struct {
+		expr string
+		msg  string
+	}{
+		{"(type=a", "bdog: invalid filter: expected ')' at end of expression"},
+		{"type=a)", "bdog: invalid filter: unexpected token at position 7 near ')'"},
+		{"(type=a))", "bdog: invalid filter: unexpected token at position 9 near ')'"},
+		{"type=a AND", "bdog: invalid filter: expected column name at end of expression"},
+		{"type=a AND OR name=b", "bdog: invalid filter: unknown column at position 12 near 'OR'"},
+		{"height > 5", "bdog: invalid filter: unknown column at position 1 near 'height'"},
+		{"type ~ a", "bdog: invalid filter: unknown operator at position 6 near '~'"},
+		{"type in a", "bdog: invalid filter: expected '(' to start list of values at position 9 near 'a'"},
+		{"type in (a b)", "bdog: invalid filter: expected ',' or ')' at position 12 near 'b'"},
+		{"name IS 5", "bdog: invalid filter: expected NULL at position 9 near '5'"},
+		{"name='abc", "bdog: invalid filter: unterminated quoted string at position 6 near ''abc'"},
+		{"(" + nested + ")", "bdog: invalid filter: expression is nested more than 32 levels deep at position 33 near '('"},
+		{"NOT " + nested, "bdog: invalid filter: expression is nested more than 32 levels deep at position 36 near '('"},
+		{strings.Repeat("NOT ", 1000) + "type=a", "bdog: invalid filter: expression is nested more than 32 levels deep at position 129 near 'NOT'"},
+	} {
+		_, _, err := tab.ExprClause(tc.expr, 0, placeholder)
+		var se *FilterSyntaxError
+		if !errors.As(err, &se) || !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("%q: got error %v, want a FilterSyntaxError", tc.expr, err)
+			continue
+		}
+		if se.Error() != tc.msg {
+			t.Errorf("%q: got error %q, want %q", tc.expr, se, tc.msg)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package bdog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldList returns the columns to return for the "_fields" option, i.e. the
+// Key columns followed by the comma-separated column names in "_fields", or
+// all Columns if not given.
+//
+// Unknown column names result in an ErrInvalidFilter error.
+func (t *Table) FieldList(opts map[string][]string) (ColumnSet, error) {
+	fields, ok := opts["_fields"]
+	if !ok || len(fields) == 0 {
+		return t.Columns, nil
+	}
+
+	cols := append(ColumnSet{}, t.Key...)
+	seen := make(map[string]bool)
+	for _, kc := range t.Key {
+		seen[kc] = true
+	}
+	for _, f := range fields {
+		for _, cn := range strings.Split(f, ",") {
+			cn = strings.TrimSpace(cn)
+			if cn == "" || seen[cn] {
+				continue
+			}
+			if !t.HasColumn(cn) {
+				return nil, fmt.Errorf("%w: unknown field '%s'", ErrInvalidFilter, cn)
+			}
+			seen[cn] = true
+			cols = append(cols, cn)
+		}
+	}
+	return cols, nil
+}
+
+// SelectColumns returns the column list for a SELECT statement, using the
+// comma-separated column names in the "_fields" option (or "*" if not given).
+// The Key columns and any extra column names are always included, so that
+// results can still be linked and paginated.
+//
+// Unknown column names result in an ErrInvalidFilter error.
+func (t *Table) SelectColumns(opts map[string][]string, extra ...string) (string, error) {
+	if fields, ok := opts["_fields"]; !ok || len(fields) == 0 {
+		return "*", nil
+	}
+	cols, err := t.FieldList(opts)
+	if err != nil {
+		return "", err
+	}
+	seen := make(map[string]bool, len(cols))
+	for _, cn := range cols {
+		seen[cn] = true
+	}
+	for _, cn := range extra {
+		if !seen[cn] {
+			seen[cn] = true
+			cols = append(cols, cn)
+		}
+	}
+	return strings.Join(cols, ", "), nil
+}
+
+// LinkedColumns returns the foreign key columns in this table for any of the
+// named to-one relations (see Table.RelationName). Dot-separated paths of
+// relation names (see NestLinkedPaths) use the first relation.
+func (t *Table) LinkedColumns(relations ...string) ColumnSet {
+	var res ColumnSet
+	for srcCols, others := range t.Linked {
+		cols := StringAsColumnSet(srcCols)
+		for other := range others {
+			for _, name := range relations {
+				if i := strings.IndexByte(name, '.'); i != -1 {
+					name = name[:i]
+				}
+				if t.RelationName(cols, other) == name {
+					res = append(res, cols...)
+					break
+				}
+			}
+		}
+	}
+	return res
+}
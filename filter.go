@@ -0,0 +1,146 @@
+package bdog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FilterOperators lists the operators that can be used in listing filters
+// of the form "column[op]=value", e.g. "elevation_ft[gte]=5000".
+//
+//	eq, ne          equal / not equal (the default operator is eq)
+//	gt, gte, lt, lte  numeric or lexical comparisons
+//	like            SQL LIKE pattern match, using % and _ wildcards
+//	in, nin         value is (not) in a comma-separated list of values
+//	null            column IS NULL (=true) or IS NOT NULL (=false)
+var FilterOperators = []string{"eq", "ne", "gt", "gte", "lt", "lte", "like", "in", "nin", "null"}
+
+var filterSQL = map[string]string{
+	"eq":   "=",
+	"ne":   "<>",
+	"gt":   ">",
+	"gte":  ">=",
+	"lt":   "<",
+	"lte":  "<=",
+	"like": "LIKE",
+	"in":   "IN",
+	"nin":  "NOT IN",
+}
+
+// ParseFilterName splits a filter variable name of the form "column[op]"
+// into the column name and operator. Plain column names use the "eq" operator.
+func ParseFilterName(name string) (column, op string) {
+	i := strings.IndexByte(name, '[')
+	if i == -1 || !strings.HasSuffix(name, "]") {
+		return name, "eq"
+	}
+	return name[:i], name[i+1 : len(name)-1]
+}
+
+// FilterClause builds a parameterized SQL condition for the filter variable
+// name (a "column" or "column[op]") and its query values, returning the
+// condition and the arguments it uses. The placeholder function returns
+// the parameter placeholder for the n-th argument, where numbering starts
+// after the given number of existing arguments. Values are converted using
+// FilterArg.
+//
+// Unknown columns or operators result in an ErrInvalidFilter error.
+func (t *Table) FilterClause(name string, vals []string, nargs int, placeholder func(n int) string) (string, []interface{}, error) {
+	col, op := ParseFilterName(name)
+	if !t.HasColumn(col) {
+		return "", nil, fmt.Errorf("%w: unknown column '%s'", ErrInvalidFilter, col)
+	}
+	if len(vals) == 0 {
+		return "", nil, fmt.Errorf("%w: missing value for '%s'", ErrInvalidFilter, name)
+	}
+
+	switch op {
+	case "null":
+		switch strings.ToLower(vals[0]) {
+		case "true", "1", "yes":
+			return col + " IS NULL", nil, nil
+		case "false", "0", "no":
+			return col + " IS NOT NULL", nil, nil
+		}
+		return "", nil, fmt.Errorf("%w: '%s' expects true or false", ErrInvalidFilter, name)
+
+	case "in", "nin":
+		var args []interface{}
+		var phs []string
+		for _, v := range vals {
+			for _, x := range strings.Split(v, ",") {
+				args = append(args, t.FilterArg(col, x))
+				phs = append(phs, placeholder(nargs+len(args)))
+			}
+		}
+		return fmt.Sprintf("%s %s (%s)", col, filterSQL[op], strings.Join(phs, ",")), args, nil
+	}
+
+	sqlop, ok := filterSQL[op]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: unknown operator '%s' (available: %s)",
+			ErrInvalidFilter, op, strings.Join(FilterOperators, ", "))
+	}
+	return fmt.Sprintf("%s %s %s", col, sqlop, placeholder(nargs+1)), []interface{}{t.FilterArg(col, vals[0])}, nil
+}
+
+// WhereClause builds the WHERE clause (including the leading " WHERE ", or
+// empty if there are no conditions) and query arguments for the listing
+// filters in opts, i.e. the "_where" and "_args" conditions combined with
+// any "_filters", "_q" expressions, "_search" terms (when the table has
+// no FullTextIndex) and geospatial options (see GeoClause). opts is not
+// modified.
+func (t *Table) WhereClause(opts map[string][]string, placeholder func(n int) string) (string, []interface{}, error) {
+	var where []string
+	var args []interface{}
+	if opts != nil {
+		where = append(where, opts["_where"]...)
+		for _, a := range opts["_args"] {
+			args = append(args, a)
+		}
+
+		for _, varname := range opts["_filters"] {
+			clause, fargs, err := t.FilterClause(varname, opts[varname], len(args), placeholder)
+			if err != nil {
+				return "", nil, err
+			}
+			where = append(where, clause)
+			args = append(args, fargs...)
+		}
+		for _, expr := range opts["_q"] {
+			clause, qargs, err := t.ExprClause(expr, len(args), placeholder)
+			if err != nil {
+				return "", nil, err
+			}
+			where = append(where, clause)
+			args = append(args, qargs...)
+		}
+		if _, ok := opts["_search"]; ok && !t.IsSearchable() {
+			return "", nil, fmt.Errorf("%w: %s cannot be searched", ErrInvalidFilter, t.PluralName(true))
+		}
+		// full-text indexes are queried by the driver
+		if t.FullTextIndex == "" {
+			for _, search := range opts["_search"] {
+				clause, sa := t.SearchClause(search, len(args), placeholder)
+				if clause != "" {
+					where = append(where, clause)
+					for _, a := range sa {
+						args = append(args, a)
+					}
+				}
+			}
+		}
+		clause, err := t.GeoClause(opts)
+		if err != nil {
+			return "", nil, err
+		}
+		if clause != "" {
+			where = append(where, clause)
+		}
+	}
+
+	if len(where) == 0 {
+		return "", args, nil
+	}
+	return " WHERE " + strings.Join(where, " AND "), args, nil
+}
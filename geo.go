@@ -0,0 +1,205 @@
+package bdog
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// kmPerDegree is the length of one degree of latitude in kilometers,
+// using the mean radius of the Earth (6371km).
+const kmPerDegree = 6371.0 * math.Pi / 180.0
+
+var (
+	latitudeNames  = []string{"lat", "latitude"}
+	longitudeNames = []string{"lon", "lng", "long", "longitude"}
+)
+
+// GeoColumns finds a pair of numeric latitude and longitude columns in the
+// table, matched by name (e.g. "latitude_deg" and "longitude_deg", or
+// "start_lat" and "start_lng"). ok is false if there is no such pair.
+func (t *Table) GeoColumns() (lat, lon string, ok bool) {
+	numeric := make(map[string]string)
+	for _, col := range t.Columns {
+		ct := t.ColumnInfo[col].Type
+		if ct == IntegerType || ct == RealType {
+			numeric[strings.ToLower(col)] = col
+		}
+	}
+	for _, col := range t.Columns {
+		if _, isNum := numeric[strings.ToLower(col)]; !isNum {
+			continue
+		}
+		parts := strings.Split(strings.ToLower(col), "_")
+		for i, p := range parts {
+			if !containsString(latitudeNames, p) {
+				continue
+			}
+			for _, lonName := range longitudeNames {
+				parts[i] = lonName
+				if other, found := numeric[strings.Join(parts, "_")]; found {
+					return col, other, true
+				}
+			}
+			parts[i] = p
+		}
+	}
+	return "", "", false
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCoords parses a comma-separated list of n numbers.
+func parseCoords(name, s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("%w: %s expects %d comma-separated numbers", ErrInvalidFilter, name, n)
+	}
+	res := make([]float64, n)
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("%w: %s expects %d comma-separated numbers", ErrInvalidFilter, name, n)
+		}
+		res[i] = f
+	}
+	return res, nil
+}
+
+// sqlFloat formats a number as a SQL literal. Coordinates are always parsed
+// using parseCoords, so are safe to include in queries directly (which also
+// avoids reusing placeholders in different parts of the query).
+func sqlFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// GeoClause builds a SQL condition for the geospatial options in opts:
+//
+//	"_bbox" as minLon,minLat,maxLon,maxLat restricts results to a bounding box
+//	  (where minLon > maxLon if the box crosses the antimeridian)
+//	"_near" as lat,lon with "_radius_km" restricts results to a radius
+//
+// Distances use an equirectangular approximation, which is accurate enough
+// for a few hundred kilometers but does not wrap around the antimeridian.
+// It returns an empty condition if there are no geospatial options, and an
+// ErrInvalidFilter error if the options are invalid or the table has no
+// GeoColumns.
+func (t *Table) GeoClause(opts map[string][]string) (string, error) {
+	bbox, hasBBox := opts["_bbox"]
+	near, hasNear := opts["_near"]
+	radius, hasRadius := opts["_radius_km"]
+	if !hasBBox && !hasNear && !hasRadius {
+		return "", nil
+	}
+	lat, lon, ok := t.GeoColumns()
+	if !ok {
+		return "", fmt.Errorf("%w: %s do not have latitude and longitude fields", ErrInvalidFilter, t.PluralName(true))
+	}
+
+	var conds []string
+	if hasBBox && len(bbox) > 0 {
+		b, err := parseCoords("_bbox", bbox[0], 4)
+		if err != nil {
+			return "", err
+		}
+		minLon, minLat, maxLon, maxLat := b[0], b[1], b[2], b[3]
+		if minLat > maxLat {
+			return "", fmt.Errorf("%w: _bbox minimum latitude is greater than the maximum", ErrInvalidFilter)
+		}
+		conds = append(conds, fmt.Sprintf("%s BETWEEN %s AND %s", lat, sqlFloat(minLat), sqlFloat(maxLat)))
+		if minLon <= maxLon {
+			conds = append(conds, fmt.Sprintf("%s BETWEEN %s AND %s", lon, sqlFloat(minLon), sqlFloat(maxLon)))
+		} else {
+			conds = append(conds, fmt.Sprintf("(%s >= %s OR %s <= %s)", lon, sqlFloat(minLon), lon, sqlFloat(maxLon)))
+		}
+	}
+
+	if hasRadius {
+		if !hasNear {
+			return "", fmt.Errorf("%w: _radius_km requires _near", ErrInvalidFilter)
+		}
+		r, err := parseCoords("_radius_km", radius[0], 1)
+		if err != nil {
+			return "", err
+		}
+		if r[0] <= 0 {
+			return "", fmt.Errorf("%w: _radius_km must be positive", ErrInvalidFilter)
+		}
+		p, err := parseNear(near)
+		if err != nil {
+			return "", err
+		}
+		dLat := r[0] / kmPerDegree
+		// a bounding box first, so that indexes can be used
+		conds = append(conds, fmt.Sprintf("%s BETWEEN %s AND %s", lat, sqlFloat(p[0]-dLat), sqlFloat(p[0]+dLat)))
+		if k := math.Cos(p[0] * math.Pi / 180.0); k > 0.01 {
+			dLon := dLat / k
+			conds = append(conds, fmt.Sprintf("%s BETWEEN %s AND %s", lon, sqlFloat(p[1]-dLon), sqlFloat(p[1]+dLon)))
+		}
+		conds = append(conds, distanceSQL(lat, lon, p)+" <= "+sqlFloat(dLat*dLat))
+	} else if hasNear {
+		if _, err := parseNear(near); err != nil {
+			return "", err
+		}
+	}
+
+	return strings.Join(conds, " AND "), nil
+}
+
+func parseNear(near []string) ([]float64, error) {
+	if len(near) == 0 {
+		return nil, fmt.Errorf("%w: _near expects 2 comma-separated numbers", ErrInvalidFilter)
+	}
+	p, err := parseCoords("_near", near[0], 2)
+	if err != nil {
+		return nil, err
+	}
+	if p[0] < -90 || p[0] > 90 || p[1] < -180 || p[1] > 180 {
+		return nil, fmt.Errorf("%w: _near expects a valid latitude and longitude", ErrInvalidFilter)
+	}
+	return p, nil
+}
+
+// distanceSQL returns a SQL expression for the squared distance (in degrees
+// of latitude) between the lat/lon columns and the point p.
+func distanceSQL(lat, lon string, p []float64) string {
+	k := sqlFloat(math.Cos(p[0] * math.Pi / 180.0))
+	dy := fmt.Sprintf("(%s - %s)", lat, sqlFloat(p[0]))
+	dx := fmt.Sprintf("((%s - %s) * %s)", lon, sqlFloat(p[1]), k)
+	return fmt.Sprintf("(%s * %s + %s * %s)", dy, dy, dx, dx)
+}
+
+// DistanceOrder returns the ORDER BY terms to sort results by their distance
+// from the "_near" point in opts, or an empty string if results should not be
+// ordered by distance (e.g. "_sortby" or "_cursor" were given). Rows without
+// coordinates have no distance, so are sorted last.
+func (t *Table) DistanceOrder(opts map[string][]string) string {
+	near, ok := opts["_near"]
+	if !ok {
+		return ""
+	}
+	if _, sorted := opts["_sortby"]; sorted {
+		return ""
+	}
+	if _, seek := opts["_cursor"]; seek {
+		return ""
+	}
+	lat, lon, ok := t.GeoColumns()
+	if !ok {
+		return ""
+	}
+	p, err := parseNear(near)
+	if err != nil {
+		return ""
+	}
+	dist := distanceSQL(lat, lon, p)
+	return dist + " IS NULL, " + dist
+}
@@ -3,10 +3,13 @@ module github.com/pbnjay/bdog
 go 1.19
 
 require (
-	github.com/gertd/go-pluralize v0.2.1 // indirect
-	github.com/julienschmidt/httprouter v1.3.0 // indirect
-	github.com/mattn/go-sqlite3 v1.14.16 // indirect
-	golang.org/x/crypto v0.2.0 // indirect
-	golang.org/x/sys v0.2.0 // indirect
-	golang.org/x/text v0.4.0 // indirect
+	github.com/gertd/go-pluralize v0.2.1
+	github.com/go-sql-driver/mysql v1.7.0
+	github.com/julienschmidt/httprouter v1.3.0
+	github.com/lib/pq v1.10.7
+	github.com/mattn/go-sqlite3 v1.14.16
+	golang.org/x/crypto v0.2.0
+	golang.org/x/text v0.4.0
 )
+
+require golang.org/x/sys v0.2.0 // indirect
@@ -0,0 +1,192 @@
+package bdog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxNestArgs limits the number of query arguments used to fetch each batch
+// of linked rows, to stay within the limits of all databases.
+const maxNestArgs = 500
+
+// NestLinked adds the row from tab2 linked by the to-one relation rel to each
+// of the rows, using the relation name. Linked rows are fetched with batched
+// "key IN (...)" queries using the list function (e.g. Driver.Listing) and the
+// placeholders for the driver, instead of a query for each row. Rows without a
+// linked row are given a nil value.
+func NestLinked(rows []interface{}, rel Relation, tab2 Table, placeholder func(n int) string,
+	list func(tab Table, opts map[string][]string) ([]interface{}, error)) error {
+	fkCols := rel.Columns
+
+	// collect the distinct foreign key values, before the relation name
+	// (which may be the same as a foreign key column) is set
+	rowKeys := make([]string, len(rows))
+	hasKey := make([]bool, len(rows))
+	var keys [][]string
+	seen := make(map[string]bool)
+	for ri, x := range rows {
+		row := x.(map[string]interface{})
+		key := make([]string, len(fkCols))
+		for i, fk := range fkCols {
+			if row[fk] == nil {
+				key = nil
+				break
+			}
+			key[i] = fmt.Sprint(row[fk])
+		}
+		row[rel.Name] = nil
+		if key == nil {
+			continue
+		}
+		rowKeys[ri] = strings.Join(key, "\x00")
+		hasKey[ri] = true
+		if !seen[rowKeys[ri]] {
+			seen[rowKeys[ri]] = true
+			keys = append(keys, key)
+		}
+	}
+
+	linked := make(map[string]interface{}, len(keys))
+	batchSize := maxNestArgs / len(fkCols)
+	for len(keys) > 0 {
+		batch := keys
+		if len(batch) > batchSize {
+			batch = keys[:batchSize]
+		}
+		keys = keys[len(batch):]
+
+		var args, conds []string
+		for _, key := range batch {
+			var match []string
+			for i, kc := range tab2.Key {
+				args = append(args, key[i])
+				match = append(match, kc+"="+placeholder(len(args)))
+			}
+			conds = append(conds, strings.Join(match, " AND "))
+		}
+		clause := tab2.Key[0] + " IN (" + strings.Join(placeholdersFor(1, len(args), placeholder), ",") + ")"
+		if len(tab2.Key) > 1 {
+			clause = "((" + strings.Join(conds, ") OR (") + "))"
+		}
+
+		opts := map[string][]string{
+			"_where":     {clause},
+			"_args":      args,
+			"_unlimited": nil,
+		}
+		res, err := list(tab2, opts)
+		if err != nil {
+			return err
+		}
+		for _, x := range res {
+			row := x.(map[string]interface{})
+			key := make([]string, len(tab2.Key))
+			for i, kc := range tab2.Key {
+				key[i] = fmt.Sprint(row[kc])
+			}
+			linked[strings.Join(key, "\x00")] = row
+		}
+	}
+
+	for ri, x := range rows {
+		if match, ok := linked[rowKeys[ri]]; ok && hasKey[ri] {
+			x.(map[string]interface{})[rel.Name] = match
+		}
+	}
+	return nil
+}
+
+// NestLinkedPaths nests linked rows in the rows from tab for each of the
+// paths, given as dot-separated to-one relation names (see Table.Relations).
+// Each relation in a path is nested in the rows of the previous one using
+// NestLinked, e.g. "region.country" nests the region of each row, and the
+// country of each region. Relations shared by several paths (e.g. "region"
+// and "region.country") are only fetched once.
+func NestLinkedPaths(rows []interface{}, tab Table, paths []string, getTable func(name string) Table,
+	placeholder func(n int) string, list func(tab Table, opts map[string][]string) ([]interface{}, error)) error {
+	// the rows nested for each path prefix, to be used for the next relation
+	nested := make(map[string][]interface{})
+	for _, path := range paths {
+		level, levelTab := rows, tab
+		prefix := ""
+		for _, name := range strings.Split(path, ".") {
+			rel, ok := levelTab.Relation(name, getTable)
+			if !ok {
+				return ErrInvalidInclude
+			}
+			tab2 := getTable(rel.Table)
+			prefix += "." + name
+			next, done := nested[prefix]
+			if !done {
+				err := NestLinked(level, rel, tab2, placeholder, list)
+				if err != nil {
+					return err
+				}
+				for _, x := range level {
+					if row, ok := x.(map[string]interface{})[name].(map[string]interface{}); ok {
+						next = append(next, row)
+					}
+				}
+				nested[prefix] = next
+			}
+			level, levelTab = next, tab2
+		}
+	}
+	return nil
+}
+
+// SubqueryClause builds a SQL condition matching the rows of table2 linked to
+// the row of table1 with the key values (one for each column of table1.Key),
+// using the column mappings from Model.GetRelatedTableMappings(table1, table2).
+// Multi-column mappings are matched on every column, and rows linked by any of
+// the mappings match. The arguments for the condition are numbered from
+// nargs+1, and are repeated for each mapping so that positional placeholders
+// can be used. If via is given, only the mappings to those columns of table2
+// are used (e.g. the Columns of a Relation from Table.ChildRelations). Tables
+// without direct mappings are matched through their ManyToMany junction
+// tables, and an empty condition is returned if the tables are not linked.
+func SubqueryClause(table1, table2 Table, colmaps map[ColumnSetString][]ColumnSet, via ColumnSet, key []string,
+	nargs int, placeholder func(n int) string) (string, []string) {
+	var lefts []string
+	for left := range colmaps {
+		lefts = append(lefts, string(left))
+	}
+	sort.Strings(lefts)
+
+	var args, conds []string
+	for _, left := range lefts {
+		leftCols := StringAsColumnSet(ColumnSetString(left))
+		for _, right := range colmaps[ColumnSetString(left)] {
+			if via != nil && !via.IsEqual(right) {
+				continue
+			}
+			// table1 is aliased, in case it is the same table as table2
+			var match []string
+			for i, kc := range table1.Key {
+				args = append(args, key[i])
+				match = append(match, "_t1."+kc+"="+placeholder(nargs+len(args)))
+			}
+			for i, lc := range leftCols {
+				match = append(match, "_t1."+lc+"="+table2.Name+"."+right[i])
+			}
+			conds = append(conds, "EXISTS (SELECT 1 FROM "+table1.Name+" AS _t1 WHERE "+strings.Join(match, " AND ")+")")
+		}
+	}
+	if len(conds) == 0 {
+		return junctionClause(table1, table2, key, nargs, placeholder)
+	}
+	if len(conds) == 1 {
+		return conds[0], args
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", args
+}
+
+// placeholdersFor returns the placeholders for arguments first to last.
+func placeholdersFor(first, last int, placeholder func(n int) string) []string {
+	res := make([]string, 0, last-first+1)
+	for n := first; n <= last; n++ {
+		res = append(res, placeholder(n))
+	}
+	return res
+}
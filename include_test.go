@@ -0,0 +1,144 @@
+package bdog
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSubqueryClauseCompositeKey(t *testing.T) {
+	courses := Table{Name: "courses", Key: ColumnSet{"dept", "number"}}
+	sections := Table{Name: "sections", Key: ColumnSet{"dept", "course_number", "term", "section"}}
+	colmaps := map[ColumnSetString][]ColumnSet{
+		"dept,number": {{"dept", "course_number"}},
+	}
+	placeholder := func(n int) string { return fmt.Sprintf("$%d", n) }
+
+	for _, tc := range []struct {
+		name     string
+		nargs    int
+		want     string
+		wantArgs []string
+	}{
+		{"no args", 0,
+			"EXISTS (SELECT 1 FROM courses AS _t1 WHERE _t1.dept=$1 AND _t1.number=$2" +
+				" AND _t1.dept=sections.dept AND _t1.number=sections.course_number)",
+			[]string{"MATH", "101"}},
+		{"after other args", 2,
+			"EXISTS (SELECT 1 FROM courses AS _t1 WHERE _t1.dept=$3 AND _t1.number=$4" +
+				" AND _t1.dept=sections.dept AND _t1.number=sections.course_number)",
+			[]string{"MATH", "101"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, args := SubqueryClause(courses, sections, colmaps, nil, []string{"MATH", "101"}, tc.nargs, placeholder)
+			if got != tc.want {
+				t.Errorf("clause = %q, want %q", got, tc.want)
+			}
+			if !reflect.DeepEqual(args, tc.wantArgs) {
+				t.Errorf("args = %q, want %q", args, tc.wantArgs)
+			}
+		})
+	}
+
+	// only the via columns are used when given
+	got, args := SubqueryClause(courses, sections, colmaps, ColumnSet{"dept", "term"}, []string{"MATH", "101"}, 0, placeholder)
+	if got != "" || len(args) != 0 {
+		t.Errorf("clause using other columns = %q %q, want none", got, args)
+	}
+}
+
+// TestNestLinkedPathsBatches checks that linked rows are fetched with a query
+// for each relation in the include paths (or for each batch of maxNestArgs
+// keys), rather than for each row.
+func TestNestLinkedPathsBatches(t *testing.T) {
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "nest.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.Exec(`
+		CREATE TABLE countries (code TEXT PRIMARY KEY, name TEXT);
+		CREATE TABLE regions (id INTEGER PRIMARY KEY, country_code TEXT);
+		CREATE TABLE airports (ident INTEGER PRIMARY KEY, region_id INTEGER);
+		INSERT INTO countries VALUES ('US', 'United States'), ('CA', 'Canada');
+		WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i+1 FROM n WHERE i < 1200)
+		INSERT INTO regions SELECT i, CASE WHEN i % 3 = 0 THEN 'CA' ELSE 'US' END FROM n WHERE i <= 600;
+		WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i+1 FROM n WHERE i < 1200)
+		INSERT INTO airports SELECT i, (i - 1) % 600 + 1 FROM n;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := ColumnInfo{SQLType: "TEXT", Type: TextType}
+	integer := ColumnInfo{SQLType: "INTEGER", Type: IntegerType}
+	m := NewSQLModel(conn, Dialect{Placeholder: func(n int) string { return fmt.Sprint("$", n) }}, map[string]Table{
+		"countries": {Name: "countries", Columns: ColumnSet{"code", "name"}, Key: ColumnSet{"code"},
+			ColumnInfo: map[string]ColumnInfo{"code": text, "name": text},
+			RevLinked:  map[string]struct{}{"regions": {}}},
+		"regions": {Name: "regions", Columns: ColumnSet{"id", "country_code"}, Key: ColumnSet{"id"},
+			ColumnInfo: map[string]ColumnInfo{"id": integer, "country_code": text},
+			Linked:     map[ColumnSetString]map[string][]ColumnSet{"country_code": {"countries": {{"code"}}}},
+			RevLinked:  map[string]struct{}{"airports": {}}},
+		"airports": {Name: "airports", Columns: ColumnSet{"ident", "region_id"}, Key: ColumnSet{"ident"},
+			ColumnInfo: map[string]ColumnInfo{"ident": integer, "region_id": integer},
+			Linked:     map[ColumnSetString]map[string][]ColumnSet{"region_id": {"regions": {{"id"}}}}},
+	})
+
+	for _, tc := range []struct {
+		perPage string
+		paths   []string
+		queries map[string]int
+	}{
+		{"10", []string{"region.country"}, map[string]int{"regions": 1, "countries": 1}},
+		{"10", []string{"region", "region.country"}, map[string]int{"regions": 1, "countries": 1}},
+		{"10", []string{"region"}, map[string]int{"regions": 1}},
+		// 600 distinct regions need two batches
+		{"1000", []string{"region.country"}, map[string]int{"regions": 2, "countries": 1}},
+	} {
+		queries := make(map[string]int)
+		list := func(tab Table, opts map[string][]string) ([]interface{}, error) {
+			queries[tab.Name]++
+			return m.Listing(tab, opts)
+		}
+		airports := m.GetTable("airports")
+		rows, err := m.Listing(airports, map[string][]string{"_perpage": {tc.perPage}, "_maxperpage": {tc.perPage}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = NestLinkedPaths(rows, airports, tc.paths, m.GetTable, m.dialect.Placeholder, list); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(queries, tc.queries) {
+			t.Errorf("%s rows %v: queries = %v, want %v", tc.perPage, tc.paths, queries, tc.queries)
+		}
+		for _, x := range rows {
+			row := x.(map[string]interface{})
+			region, _ := row["region"].(map[string]interface{})
+			if region == nil || region["id"] != row["region_id"] {
+				t.Errorf("%v: airport %v has region %v", tc.paths, row["ident"], row["region"])
+				break
+			}
+			if strings.Contains(strings.Join(tc.paths, ","), ".country") {
+				country, _ := region["country"].(map[string]interface{})
+				if country == nil || country["code"] != region["country_code"] {
+					t.Errorf("%v: region %v has country %v", tc.paths, region["id"], region["country"])
+					break
+				}
+			}
+		}
+	}
+
+	// only to-one relations can be included
+	rows, err := m.Listing(m.GetTable("regions"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"airports", "country.regions", "country.name", "nope"} {
+		err = NestLinkedPaths(rows, m.GetTable("regions"), []string{path}, m.GetTable, m.dialect.Placeholder, m.Listing)
+		if err != ErrInvalidInclude {
+			t.Errorf("%s: got error %v, want ErrInvalidInclude", path, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package bdog
+
+import (
+	"sort"
+	"strings"
+)
+
+// JunctionLink is a many-to-many relationship to another table through a
+// junction table.
+type JunctionLink struct {
+	// Junction is the name of the junction table.
+	Junction string
+
+	// From are the columns of the junction table linked to the Key of this Table.
+	From ColumnSet
+
+	// To are the columns of the junction table linked to the Key of the other table.
+	To ColumnSet
+}
+
+// LinkJunctions finds the junction tables in tabs, which are tables whose Key
+// is made of two foreign keys to the Keys of other tables, with no tables
+// linking to them and no other columns except dates (e.g. a "created_at"
+// timestamp), so that tables with data of their own (e.g. the quantity in an
+// order_items table) keep their routes. Junction tables are marked
+// with IsJunction, and the tables they link are given ManyToMany links to
+// each other.
+func LinkJunctions(tabs map[string]Table) {
+	for name, tab := range tabs {
+		if len(tab.RevLinked) > 0 || hasDataColumns(tab) {
+			continue
+		}
+
+		// foreign keys within the Key, linking to another table's Key
+		type keyLink struct {
+			cols  ColumnSet
+			table string
+		}
+		var links []keyLink
+		var fkeys []string
+		for fk := range tab.Linked {
+			fkeys = append(fkeys, string(fk))
+		}
+		sort.Strings(fkeys)
+		for _, fk := range fkeys {
+			cols := StringAsColumnSet(ColumnSetString(fk))
+			if !tab.Key.Contains(cols...) {
+				continue
+			}
+			var others []string
+			for tn := range tab.Linked[ColumnSetString(fk)] {
+				others = append(others, tn)
+			}
+			sort.Strings(others)
+			for _, tn := range others {
+				for _, toCols := range tab.Linked[ColumnSetString(fk)][tn] {
+					if tabs[tn].Key.IsEqual(toCols) {
+						links = append(links, keyLink{cols: cols, table: tn})
+					}
+				}
+			}
+		}
+		if len(links) != 2 || len(links[0].cols)+len(links[1].cols) != len(tab.Key) {
+			continue
+		}
+		overlap := false
+		for _, col := range links[1].cols {
+			overlap = overlap || links[0].cols.Contains(col)
+		}
+		if overlap {
+			continue
+		}
+
+		tab.IsJunction = true
+		tabs[name] = tab
+		for i, link := range links {
+			other := links[1-i]
+			linked := tabs[link.table]
+			if linked.ManyToMany == nil {
+				linked.ManyToMany = make(map[string][]JunctionLink)
+			}
+			linked.ManyToMany[other.table] = append(linked.ManyToMany[other.table],
+				JunctionLink{Junction: name, From: link.cols, To: other.cols})
+			tabs[link.table] = linked
+		}
+	}
+}
+
+// hasDataColumns returns true if tab has columns other than its Key and
+// DateType columns.
+func hasDataColumns(tab Table) bool {
+	for _, col := range tab.Columns {
+		if !tab.Key.Contains(col) && tab.ColumnInfo[col].Type != DateType {
+			return true
+		}
+	}
+	return false
+}
+
+// junctionClause builds a SQL condition matching the rows of table2 linked to
+// the row of table1 with the key values through any of the junction tables in
+// table1.ManyToMany. Arguments are numbered from nargs+1.
+func junctionClause(table1, table2 Table, key []string, nargs int, placeholder func(n int) string) (string, []string) {
+	var args, conds []string
+	for _, link := range table1.ManyToMany[table2.Name] {
+		var match []string
+		for i, fc := range link.From {
+			args = append(args, key[i])
+			match = append(match, link.Junction+"."+fc+"="+placeholder(nargs+len(args)))
+		}
+		for i, tc := range link.To {
+			match = append(match, link.Junction+"."+tc+"="+table2.Name+"."+table2.Key[i])
+		}
+		conds = append(conds, "EXISTS (SELECT 1 FROM "+link.Junction+" WHERE "+strings.Join(match, " AND ")+")")
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	if len(conds) == 1 {
+		return conds[0], args
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", args
+}
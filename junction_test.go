@@ -0,0 +1,46 @@
+package bdog
+
+import "testing"
+
+func TestLinkJunctions(t *testing.T) {
+	integer := ColumnInfo{SQLType: "INTEGER", Type: IntegerType}
+	keyInfo := map[string]ColumnInfo{"id": integer}
+	linkTo := func(cols map[string]string) map[ColumnSetString]map[string][]ColumnSet {
+		linked := make(map[ColumnSetString]map[string][]ColumnSet)
+		for col, tn := range cols {
+			linked[ColumnSetAsString(ColumnSet{col})] = map[string][]ColumnSet{tn: {{"id"}}}
+		}
+		return linked
+	}
+	tabs := map[string]Table{
+		"orders":   {Name: "orders", Columns: ColumnSet{"id"}, Key: ColumnSet{"id"}, ColumnInfo: keyInfo},
+		"products": {Name: "products", Columns: ColumnSet{"id"}, Key: ColumnSet{"id"}, ColumnInfo: keyInfo},
+		"tags":     {Name: "tags", Columns: ColumnSet{"id"}, Key: ColumnSet{"id"}, ColumnInfo: keyInfo},
+		"order_items": {Name: "order_items",
+			Columns: ColumnSet{"order_id", "product_id", "quantity", "price"},
+			Key:     ColumnSet{"order_id", "product_id"},
+			ColumnInfo: map[string]ColumnInfo{"order_id": integer, "product_id": integer, "quantity": integer,
+				"price": {SQLType: "REAL", Type: RealType}},
+			Linked: linkTo(map[string]string{"order_id": "orders", "product_id": "products"})},
+		"product_tags": {Name: "product_tags",
+			Columns: ColumnSet{"product_id", "tag_id", "created_at"},
+			Key:     ColumnSet{"product_id", "tag_id"},
+			ColumnInfo: map[string]ColumnInfo{"product_id": integer, "tag_id": integer,
+				"created_at": {SQLType: "TIMESTAMP", Type: DateType}},
+			Linked: linkTo(map[string]string{"product_id": "products", "tag_id": "tags"})},
+	}
+	LinkJunctions(tabs)
+
+	if tabs["order_items"].IsJunction {
+		t.Error("order_items has data columns, but is a junction table")
+	}
+	if len(tabs["orders"].ManyToMany) != 0 {
+		t.Errorf("orders ManyToMany = %v, want none", tabs["orders"].ManyToMany)
+	}
+	if !tabs["product_tags"].IsJunction {
+		t.Error("product_tags is not a junction table")
+	}
+	if links := tabs["tags"].ManyToMany["products"]; len(links) != 1 || links[0].Junction != "product_tags" {
+		t.Errorf("tags ManyToMany products = %v, want product_tags", links)
+	}
+}
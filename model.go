@@ -3,6 +3,9 @@ package bdog
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"math"
+	"strconv"
 	"strings"
 
 	goplural "github.com/gertd/go-pluralize"
@@ -38,6 +41,23 @@ func (c ColumnSet) IsEqual(colset interface{}) bool {
 	panic("ColumnSet.IsEqual but not ColumnSet(String)")
 }
 
+// Contains returns true if the receiver includes all of the columns.
+func (c ColumnSet) Contains(cols ...string) bool {
+	for _, col := range cols {
+		found := false
+		for _, x := range c {
+			if x == col {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
 // IsEqual returns true if the receiver has the same columns
 // as the argument ColumnSet / ColumnSetString value
 func (c ColumnSetString) IsEqual(colset interface{}) bool {
@@ -77,6 +97,9 @@ type Table struct {
 	// Columns lists the column names in this Table.
 	Columns ColumnSet
 
+	// ColumnInfo contains type metadata for each column name in Columns.
+	ColumnInfo map[string]ColumnInfo
+
 	// UniqueColumns lists the column names containing unique values in this Table.
 	// NB these are only single columns with a UNIQUE index, no multi-column support.
 	UniqueColumns ColumnSet
@@ -91,6 +114,218 @@ type Table struct {
 
 	// RevLinked is a set of table names that link to this Table.
 	RevLinked map[string]struct{}
+
+	// FullTextIndex is the name of a full-text search table indexing the rows
+	// of this Table (e.g. a sqlite FTS5 table created with content=), if any.
+	FullTextIndex string
+
+	// FullTextRowID is the column in this Table matching the rowid of the
+	// FullTextIndex table.
+	FullTextRowID string
+
+	// SearchColumns lists the text columns to match using LIKE for "_search"
+	// queries when there is no FullTextIndex.
+	SearchColumns ColumnSet
+
+	// IsJunction is true if this Table only links the rows of two other
+	// tables in a many-to-many relationship (see LinkJunctions).
+	IsJunction bool
+
+	// ManyToMany connects table names to the junction tables linking
+	// them to this Table.
+	ManyToMany map[string][]JunctionLink
+}
+
+// IsSearchable returns true if the Table supports "_search" queries.
+func (t *Table) IsSearchable() bool {
+	return t.FullTextIndex != "" || len(t.SearchColumns) > 0
+}
+
+// ColumnType is a normalized data type, independent of the database's SQL dialect.
+type ColumnType string
+
+const (
+	// IntegerType is used for whole number columns.
+	IntegerType ColumnType = "integer"
+	// RealType is used for floating point and fixed precision numeric columns.
+	RealType ColumnType = "real"
+	// TextType is used for character data, and any columns with unknown types.
+	TextType ColumnType = "text"
+	// BlobType is used for binary data columns.
+	BlobType ColumnType = "blob"
+	// BooleanType is used for true/false columns.
+	BooleanType ColumnType = "boolean"
+	// DateType is used for date, time and timestamp columns.
+	DateType ColumnType = "date"
+)
+
+// ColumnInfo describes a single column in a Table.
+type ColumnInfo struct {
+	// SQLType is the type declared in the database schema (e.g. "VARCHAR(20)")
+	SQLType string
+
+	// Type is the normalized form of SQLType.
+	Type ColumnType
+
+	// NotNull is true if the column does not allow NULL values.
+	NotNull bool
+
+	// Default contains the column's default value expression, if any.
+	Default sql.NullString
+
+	// AutoIncrement is true if the database assigns a value when none is given.
+	AutoIncrement bool
+}
+
+// NormalizeType maps a declared SQL type to a ColumnType. It uses the SQLite
+// type affinity rules (https://www.sqlite.org/datatype3.html) with additional
+// checks for booleans and dates, which also covers the common PostgreSQL and
+// MySQL type names.
+func NormalizeType(sqlType string) ColumnType {
+	st := strings.ToLower(strings.TrimSpace(sqlType))
+	switch {
+	case st == "":
+		return TextType
+	case strings.HasPrefix(st, "bool"), st == "tinyint(1)", st == "bit(1)":
+		return BooleanType
+	case strings.HasPrefix(st, "interval"), strings.HasPrefix(st, "point"):
+		return TextType
+	case strings.Contains(st, "date"), strings.Contains(st, "time"), st == "year":
+		return DateType
+	case strings.Contains(st, "int"), strings.Contains(st, "serial"):
+		return IntegerType
+	case strings.Contains(st, "char"), strings.Contains(st, "clob"), strings.Contains(st, "text"):
+		return TextType
+	case strings.Contains(st, "blob"), strings.Contains(st, "binary"), st == "bytea":
+		return BlobType
+	case strings.Contains(st, "real"), strings.Contains(st, "floa"), strings.Contains(st, "doub"),
+		strings.Contains(st, "numeric"), strings.Contains(st, "decimal"), st == "money":
+		return RealType
+	}
+	return TextType
+}
+
+// Value converts a value scanned from this column into its native JSON
+// representation: numbers for IntegerType and RealType, booleans for
+// BooleanType, []byte (base64-encoded by encoding/json) for BlobType, and
+// nil for SQL NULL. Values that cannot be converted are returned as strings.
+func (c ColumnInfo) Value(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	if b, ok := v.([]byte); ok {
+		if c.Type == BlobType {
+			// the driver may reuse the buffer after the next Scan
+			return append([]byte(nil), b...)
+		}
+		// e.g. MySQL BIT(1) values are a single 0 or 1 byte
+		if c.Type == BooleanType && len(b) == 1 && b[0] <= 1 {
+			return b[0] == 1
+		}
+		v = string(b)
+	}
+
+	switch c.Type {
+	case IntegerType:
+		switch x := v.(type) {
+		case float64:
+			if x == float64(int64(x)) {
+				return int64(x)
+			}
+		case string:
+			if n, err := strconv.ParseInt(x, 10, 64); err == nil {
+				return n
+			}
+			if f, err := strconv.ParseFloat(x, 64); err == nil {
+				return f
+			}
+		}
+	case RealType:
+		switch x := v.(type) {
+		case int64:
+			return float64(x)
+		case string:
+			if f, err := strconv.ParseFloat(x, 64); err == nil {
+				return f
+			}
+		}
+	case BooleanType:
+		switch x := v.(type) {
+		case int64:
+			return x != 0
+		case string:
+			if b, err := strconv.ParseBool(x); err == nil {
+				return b
+			}
+		}
+	case BlobType:
+		if x, ok := v.(string); ok {
+			return []byte(x)
+		}
+	}
+	return v
+}
+
+// Format is the inverse of Value, converting a native JSON value of this
+// column back into a string query argument (e.g. to use a key value from a
+// result to look up linked rows). It returns an empty string for nil.
+func (c ColumnInfo) Format(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(x)
+	case bool:
+		if x {
+			return "1"
+		}
+		return "0"
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// ColumnArg converts the value of a column in Insert or Update opts into a
+// query argument: nil if the column is listed in the "_null" option, []byte
+// for BlobType columns, 1 or 0 for true or false BooleanType values (e.g.
+// "true" from JSON, which SQLite would store as text), or otherwise the
+// first value.
+func (t *Table) ColumnArg(colname string, opts map[string][]string) interface{} {
+	for _, cn := range opts["_null"] {
+		if cn == colname {
+			return nil
+		}
+	}
+	if t.ColumnInfo[colname].Type == BlobType {
+		return []byte(opts[colname][0])
+	}
+	return t.FilterArg(colname, opts[colname][0])
+}
+
+// FilterArg converts a value compared to a column in a listing filter into a
+// query argument: 1 or 0 for true or false BooleanType values (as stored by
+// ColumnArg), or otherwise the value unchanged.
+func (t *Table) FilterArg(colname, val string) interface{} {
+	if t.ColumnInfo[colname].Type == BooleanType {
+		if b, err := strconv.ParseBool(val); err == nil {
+			if b {
+				return int64(1)
+			}
+			return int64(0)
+		}
+	}
+	return val
+}
+
+// HasColumn returns true if name is one of the table's Columns.
+func (t *Table) HasColumn(name string) bool {
+	for _, cn := range t.Columns {
+		if cn == name {
+			return true
+		}
+	}
+	return false
 }
 
 var pluralize = goplural.NewClient()
@@ -130,17 +365,27 @@ type Model interface {
 	GetTable(t string) Table
 	ListRelatedTableNames(t string) []string
 	GetRelatedTableMappings(t1, t2 string) map[ColumnSetString][]ColumnSet
-	GetSubqueryMapping(table1, table2 Table, key string, opts map[string][]string)
+	GetSubqueryMapping(table1, table2 Table, via ColumnSet, key []string, opts map[string][]string)
 }
 
 // opts contains options for the query to pass to the driver
 //  "_filters" contains a list of column names to filter for the specified values
+//  "_q" contains boolean filter expressions (see Table.ExprClause)
+//  "_search" contains full-text search terms (see Table.SearchClause)
 //  "_where" contains additional WHERE SQL clauses for the query
 //  "_args" contains additional SQL query arguments
 //
 //  "_page" indicates which page to return
 //  "_perpage" indicates the number of results per page to display
-//  "_sortby" contains SQL query arguments to include in the ORDER BY
+//  "_maxperpage" raises the limit on "_perpage" (never set from request parameters)
+//  "_unlimited" returns all results without pagination (never set from request parameters)
+//  "_sortby" contains a list of columns to ORDER BY (see Table.ParseSortBy)
+//  "_nulls" sorts NULL values "first" or "last" (see Table.SortFields)
+//  "_cursor" contains an opaque cursor to seek to instead of "_page" (see NextCursor)
+//  "_fields" contains a list of columns to return (see Table.SelectColumns)
+//  "_group" contains a list of columns to group aggregates by (see Table.AggregateClauses)
+//  "_aggregate" contains a list of "func:column" aggregates (see Table.ParseAggregate)
+//  "_null" contains a list of columns to set to NULL in Insert and Update
 //  (column names) contain lists of values for the specified column
 
 type Driver interface {
@@ -150,11 +395,82 @@ type Driver interface {
 	Update(tab Table, opts map[string][]string) (interface{}, error)
 	Delete(tab Table, opts map[string][]string) error
 }
+
+// Counter is implemented by Drivers that can count the total number of
+// rows matching Listing options (e.g. for pagination).
+type Counter interface {
+	Count(tab Table, opts map[string][]string) (int, error)
+}
+
+// Iterator is implemented by Drivers that can stream Listing results, calling
+// fn for each row as it is read instead of collecting them all in memory.
+type Iterator interface {
+	Each(tab Table, opts map[string][]string, fn func(row map[string]interface{}) error) error
+}
+
+// Aggregator is implemented by Drivers that can compute grouped aggregates
+// (e.g. counts and averages) over the rows matching Listing options.
+type Aggregator interface {
+	Aggregate(tab Table, opts map[string][]string) ([]interface{}, error)
+}
+
+// TreeWalker is implemented by Drivers that can list the ancestors or
+// descendants of a row using a self-referencing relation (see Table.TreeQuery).
+type TreeWalker interface {
+	Tree(tab Table, rel Relation, up bool, key []string, maxDepth int, opts map[string][]string) ([]interface{}, error)
+}
+
 type RawDriver interface {
 	QueryPlaceholders(args ...interface{}) []string
 	Query(sql99 string, args ...interface{}) (*sql.Rows, error)
 }
 
+const (
+	// DefaultPerPage is the number of Listing results per page if "_perpage" is not given.
+	DefaultPerPage = 10
+	// MaxPerPage is the largest allowed "_perpage" value.
+	MaxPerPage = 500
+)
+
+// Pagination returns the 1-based page number and number of results per page
+// requested by the "_page" and "_perpage" options. Missing or invalid page
+// sizes use DefaultPerPage. Page sizes are limited to MaxPerPage, unless a
+// larger limit is given in the "_maxperpage" option (e.g. for exports).
+func Pagination(opts map[string][]string) (page, perPage int) {
+	page, perPage = 1, DefaultPerPage
+	maxPerPage := MaxPerPage
+	if mpp, ok := opts["_maxperpage"]; ok && len(mpp) > 0 {
+		n, err := strconv.Atoi(mpp[0])
+		if err == nil && n > MaxPerPage {
+			maxPerPage = n
+		}
+	}
+	if ppg, ok := opts["_perpage"]; ok && len(ppg) > 0 {
+		n, err := strconv.Atoi(ppg[0])
+		if err == nil && n >= 1 && n <= maxPerPage {
+			perPage = n
+		}
+	}
+	if pg, ok := opts["_page"]; ok && len(pg) > 0 {
+		n, err := strconv.Atoi(pg[0])
+		if err == nil && n > 1 {
+			page = n
+		}
+	}
+	return page, perPage
+}
+
+// PageOffset returns the number of results to skip for the page requested by
+// the "_page" and "_perpage" options (see Pagination). It returns an
+// ErrInvalidFilter error if the page is too large to compute the offset.
+func PageOffset(opts map[string][]string) (int, error) {
+	page, perPage := Pagination(opts)
+	if page > math.MaxInt/perPage {
+		return 0, fmt.Errorf("%w: _page is too large", ErrInvalidFilter)
+	}
+	return (page - 1) * perPage, nil
+}
+
 var (
 	// ErrNotFound is returned by Driver.Get when a record is not found.
 	ErrNotFound = errors.New("bdog: not found")
@@ -0,0 +1,28 @@
+package bdog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestColumnInfoValue(t *testing.T) {
+	for _, tc := range []struct {
+		sqlType string
+		in      interface{}
+		want    interface{}
+	}{
+		{"bit(1)", []byte{1}, true},
+		{"bit(1)", []byte{0}, false},
+		{"tinyint(1)", []byte("1"), true},
+		{"boolean", int64(0), false},
+		{"integer", []byte("42"), int64(42)},
+		{"blob", []byte{1}, []byte{1}},
+		{"text", []byte{1}, "\x01"},
+		{"bit(1)", nil, nil},
+	} {
+		ci := ColumnInfo{SQLType: tc.sqlType, Type: NormalizeType(tc.sqlType)}
+		if got := ci.Value(tc.in); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s Value(%#v) = %#v, want %#v", tc.sqlType, tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package bdog
+
+import (
+	"sort"
+	"strings"
+)
+
+// Relation is a named foreign key relationship from a table to the rows of
+// another table.
+type Relation struct {
+	// Name of the relation, used to include or embed the linked rows.
+	Name string
+
+	// Table is the name of the linked table.
+	Table string
+
+	// Columns are the foreign key columns. For to-one relations (see
+	// Table.Relations) they are in the table itself, and for to-many
+	// relations (see Table.ChildRelations) they are in the linked table.
+	Columns ColumnSet
+
+	// Junction is the name of the junction table linking the rows of a
+	// many-to-many relation (see Table.ManyToManyRelations), which has no
+	// Columns.
+	Junction string
+}
+
+// RelationName returns the name of the to-one relation using the foreign key
+// columns fk to the other table. This is the singular name of the other table
+// (e.g. "region"), or "parent" for a key to the table itself, unless there are
+// several foreign keys to it, when the names of the columns are used without
+// an "_id" suffix (e.g. "origin" and "destination" for two foreign keys to
+// airports).
+func (t *Table) RelationName(fk ColumnSet, other string) string {
+	n := 0
+	for _, others := range t.Linked {
+		n += len(others[other])
+	}
+	if n <= 1 {
+		if other == t.Name {
+			return "parent"
+		}
+		ot := Table{Name: other}
+		return ot.SingleName(false)
+	}
+	parts := make([]string, len(fk))
+	for i, col := range fk {
+		parts[i] = col
+		if len(col) > 3 && strings.EqualFold(col[len(col)-3:], "_id") {
+			parts[i] = col[:len(col)-3]
+		}
+	}
+	return strings.Join(parts, "_")
+}
+
+// Relations returns the to-one relations of the table, i.e. the foreign keys
+// to the Key of another table, sorted by name.
+func (t *Table) Relations(getTable func(name string) Table) []Relation {
+	var res []Relation
+	for fk, others := range t.Linked {
+		cols := StringAsColumnSet(fk)
+		for other, toColSets := range others {
+			for _, toCols := range toColSets {
+				if getTable(other).Key.IsEqual(toCols) {
+					res = append(res, Relation{Name: t.RelationName(cols, other), Table: other, Columns: cols})
+				}
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// Relation returns the to-one relation of the table with the name, and
+// false if there is none.
+func (t *Table) Relation(name string, getTable func(name string) Table) (Relation, bool) {
+	for _, rel := range t.Relations(getTable) {
+		if rel.Name == name {
+			return rel, true
+		}
+	}
+	return Relation{}, false
+}
+
+// ChildRelations returns the to-many relations of the table, i.e. the foreign
+// keys in other tables linking to it, sorted by name. They are named using the
+// plural name of the other table (e.g. "regions"), followed by "_as_" and the
+// to-one relation name if the other table has several foreign keys to this
+// table (e.g. "flights_as_origin"). The reverse of a "parent" relation is
+// named "children".
+func (t *Table) ChildRelations(getTable func(name string) Table) []Relation {
+	var res []Relation
+	for child := range t.RevLinked {
+		childTab := getTable(child)
+		for fk, others := range childTab.Linked {
+			if len(others[t.Name]) == 0 {
+				continue
+			}
+			cols := StringAsColumnSet(fk)
+			name := childTab.PluralName(false)
+			if relName := childTab.RelationName(cols, t.Name); relName == "parent" {
+				name = "children"
+			} else if relName != t.SingleName(false) {
+				name += "_as_" + relName
+			}
+			res = append(res, Relation{Name: name, Table: child, Columns: cols})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// ManyToManyRelations returns the relations of the table to other tables
+// through junction tables (see LinkJunctions), sorted by name. They are named
+// using the plural name of the other table (e.g. "courses"), followed by
+// "_via_" and the name of the junction table if several junction tables link
+// to it (e.g. "courses_via_waitlists").
+func (t *Table) ManyToManyRelations() []Relation {
+	var res []Relation
+	for other, links := range t.ManyToMany {
+		var junctions []string
+		for _, link := range links {
+			if !containsString(junctions, link.Junction) {
+				junctions = append(junctions, link.Junction)
+			}
+		}
+		ot := Table{Name: other}
+		for _, junction := range junctions {
+			name := ot.PluralName(false)
+			if len(junctions) > 1 {
+				name += "_via_" + junction
+			}
+			res = append(res, Relation{Name: name, Table: other, Junction: junction})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
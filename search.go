@@ -0,0 +1,62 @@
+package bdog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SearchTerms splits a "_search" query into its words.
+func SearchTerms(search string) []string {
+	return strings.Fields(search)
+}
+
+// SearchClause builds a parameterized SQL condition matching rows where every
+// word of the search query appears (case-insensitively) in at least one of the
+// SearchColumns, returning the condition and the arguments it uses.
+// Placeholders are numbered as in FilterClause. It returns an empty condition
+// if there is nothing to search.
+func (t *Table) SearchClause(search string, nargs int, placeholder func(n int) string) (string, []string) {
+	words := SearchTerms(search)
+	if len(words) == 0 || len(t.SearchColumns) == 0 {
+		return "", nil
+	}
+	var args, conds []string
+	for _, w := range words {
+		// LIKE wildcards in the search terms are matched literally
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(w)) + "%"
+		var ors []string
+		for _, col := range t.SearchColumns {
+			args = append(args, pattern)
+			ors = append(ors, fmt.Sprintf("LOWER(%s) LIKE %s ESCAPE '!'", col, placeholder(nargs+len(args))))
+		}
+		conds = append(conds, "("+strings.Join(ors, " OR ")+")")
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// likeEscaper escapes LIKE wildcards using '!', as a backslash is not
+// portable across SQL dialects.
+var likeEscaper = strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`)
+
+// FullTextQuery converts a "_search" query into a full-text MATCH query
+// which requires every word, quoting each so that punctuation in the search
+// is not interpreted as query syntax.
+func FullTextQuery(search string) string {
+	words := SearchTerms(search)
+	for i, w := range words {
+		words[i] = `"` + strings.ReplaceAll(w, `"`, `""`) + `"`
+	}
+	return strings.Join(words, " ")
+}
+
+// IsRankedSearch returns true if results are ordered by their full-text search
+// relevance, i.e. there are "_search" terms in opts to match using the
+// FullTextIndex and no other order ("_sortby" or "_cursor") was requested.
+func (t *Table) IsRankedSearch(opts map[string][]string) bool {
+	if t.FullTextIndex == "" || FullTextQuery(strings.Join(opts["_search"], " ")) == "" {
+		return false
+	}
+	_, sorted := opts["_sortby"]
+	_, seek := opts["_cursor"]
+	return !sorted && !seek
+}
@@ -0,0 +1,230 @@
+package bdog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SortField describes a column used to order listing results.
+type SortField struct {
+	// Column is the name of the column to sort by.
+	Column string
+
+	// Desc is true to sort in descending order.
+	Desc bool
+
+	// Nulls is "first" or "last" to control where NULL values are sorted,
+	// or empty to use the database's default.
+	Nulls string
+}
+
+// ParseSortBy parses a comma-separated list of sort fields, as used in the
+// "_sortby" listing option. Each field is a column name that may be prefixed
+// with "-" for descending order, or followed by ":asc" or ":desc", and
+// ":nullsfirst" or ":nullslast" modifiers. For example:
+//
+//	-elevation_ft,name
+//	elevation_ft:desc:nullslast,name:asc
+//
+// Unknown columns or modifiers result in an ErrInvalidFilter error.
+func (t *Table) ParseSortBy(sortby string) ([]SortField, error) {
+	var res []SortField
+	for _, part := range strings.Split(sortby, ",") {
+		// NB a "+" prefix is decoded as a space in URL queries
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		mods := strings.Split(part, ":")
+		sf := SortField{Column: mods[0]}
+		if strings.HasPrefix(sf.Column, "-") {
+			sf.Desc = true
+			sf.Column = sf.Column[1:]
+		} else if strings.HasPrefix(sf.Column, "+") {
+			sf.Column = sf.Column[1:]
+		}
+		if !t.HasColumn(sf.Column) {
+			return nil, fmt.Errorf("%w: unknown sort column '%s'", ErrInvalidFilter, sf.Column)
+		}
+		for _, mod := range mods[1:] {
+			switch strings.ToLower(mod) {
+			case "asc":
+				sf.Desc = false
+			case "desc":
+				sf.Desc = true
+			case "nullsfirst":
+				sf.Nulls = "first"
+			case "nullslast":
+				sf.Nulls = "last"
+			default:
+				return nil, fmt.Errorf("%w: unknown sort modifier '%s'", ErrInvalidFilter, mod)
+			}
+		}
+		res = append(res, sf)
+	}
+	return res, nil
+}
+
+// OrderByClause builds the SQL expression for an ORDER BY clause from a list
+// of sort fields. If the database does not support the NULLS FIRST/LAST
+// syntax (e.g. MySQL), set emulateNulls to sort on an IS NULL check instead.
+func OrderByClause(fields []SortField, emulateNulls bool) string {
+	parts := make([]string, 0, len(fields))
+	for _, sf := range fields {
+		if emulateNulls && sf.Nulls != "" {
+			if sf.Nulls == "first" {
+				parts = append(parts, sf.Column+" IS NULL DESC")
+			} else {
+				parts = append(parts, sf.Column+" IS NULL")
+			}
+		}
+		s := sf.Column
+		if sf.Desc {
+			s += " DESC"
+		}
+		if !emulateNulls && sf.Nulls != "" {
+			s += " NULLS " + strings.ToUpper(sf.Nulls)
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SortFields returns the fields to order Listing results by: the "_sortby"
+// option if given, or else the table's Key. The "_nulls" option ("first" or
+// "last") sets the position of NULL values for the "_sortby" fields without
+// a ":nullsfirst" or ":nullslast" modifier. Any Key columns that are not
+// already included are added, so that the order is stable across pages.
+func (t *Table) SortFields(opts map[string][]string) ([]SortField, error) {
+	var res []SortField
+	if sb, ok := opts["_sortby"]; ok && len(sb) > 0 {
+		var err error
+		res, err = t.ParseSortBy(sb[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if nulls, ok := opts["_nulls"]; ok && len(nulls) > 0 {
+		pos := strings.ToLower(nulls[0])
+		if pos != "first" && pos != "last" {
+			return nil, fmt.Errorf("%w: _nulls must be first or last", ErrInvalidFilter)
+		}
+		for i := range res {
+			if res[i].Nulls == "" {
+				res[i].Nulls = pos
+			}
+		}
+	}
+	for _, kc := range t.Key {
+		found := false
+		for _, sf := range res {
+			if sf.Column == kc {
+				found = true
+				break
+			}
+		}
+		if !found {
+			res = append(res, SortField{Column: kc})
+		}
+	}
+	return res, nil
+}
+
+// IsSeekable returns true if Listing results ordered by fields can be paged
+// using a "_cursor", i.e. all the fields are Key or NOT NULL columns, without
+// NULL ordering. Rows with NULL values could otherwise not be seeked past.
+func (t *Table) IsSeekable(fields []SortField) bool {
+	for _, sf := range fields {
+		if sf.Nulls != "" || (!t.Key.Contains(sf.Column) && !t.ColumnInfo[sf.Column].NotNull) {
+			return false
+		}
+	}
+	return true
+}
+
+// NextCursor encodes the sort field values of a row (usually the last row of
+// a page of results) into an opaque cursor for the "_cursor" Listing option.
+func NextCursor(fields []SortField, row map[string]interface{}) string {
+	vals := make([]interface{}, len(fields))
+	for i, sf := range fields {
+		vals[i] = row[sf.Column]
+	}
+	jb, err := json.Marshal(vals)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(jb)
+}
+
+// CursorClause builds a parameterized SQL condition that seeks past the row
+// encoded in the cursor, e.g. "(k1, k2) > ($1, $2)", returning the condition
+// and the arguments it uses. Placeholders are numbered, and values converted,
+// as in FilterClause.
+//
+// NB rows with NULL values in the sort fields cannot be seeked past, so
+// the fields should be checked with Table.IsSeekable.
+func (t *Table) CursorClause(cursor string, fields []SortField, nargs int, placeholder func(n int) string) (string, []interface{}, error) {
+	errInvalid := fmt.Errorf("%w: invalid cursor", ErrInvalidFilter)
+	jb, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", nil, errInvalid
+	}
+	dec := json.NewDecoder(bytes.NewReader(jb))
+	dec.UseNumber()
+	var vals []interface{}
+	if err = dec.Decode(&vals); err != nil || len(vals) != len(fields) {
+		return "", nil, errInvalid
+	}
+
+	args := make([]interface{}, len(vals))
+	for i, v := range vals {
+		if v == nil {
+			return "", nil, fmt.Errorf("%w: cursor cannot seek past NULL values in '%s'", ErrInvalidFilter, fields[i].Column)
+		}
+		args[i] = t.FilterArg(fields[i].Column, fmt.Sprint(v))
+	}
+
+	cmp := func(sf SortField) string {
+		if sf.Desc {
+			return " < "
+		}
+		return " > "
+	}
+
+	sameDir := true
+	for _, sf := range fields {
+		sameDir = sameDir && sf.Desc == fields[0].Desc
+	}
+	if sameDir {
+		cols := make([]string, len(fields))
+		phs := make([]string, len(fields))
+		for i, sf := range fields {
+			cols[i] = sf.Column
+			phs[i] = placeholder(nargs + i + 1)
+		}
+		if len(fields) == 1 {
+			return cols[0] + cmp(fields[0]) + phs[0], args, nil
+		}
+		return "(" + strings.Join(cols, ", ") + ")" + cmp(fields[0]) +
+			"(" + strings.Join(phs, ", ") + ")", args, nil
+	}
+
+	// mixed directions need the expanded form:
+	//   (a > ?) OR (a = ? AND b < ?) OR (a = ? AND b = ? AND c > ?) ...
+	var ors []string
+	var eargs []interface{}
+	for i, sf := range fields {
+		var ands []string
+		for j := 0; j < i; j++ {
+			eargs = append(eargs, args[j])
+			ands = append(ands, fields[j].Column+" = "+placeholder(nargs+len(eargs)))
+		}
+		eargs = append(eargs, args[i])
+		ands = append(ands, sf.Column+cmp(sf)+placeholder(nargs+len(eargs)))
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", eargs, nil
+}
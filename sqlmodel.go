@@ -0,0 +1,619 @@
+package bdog
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Dialect describes the SQL syntax of a database, for use by SQLModel.
+type Dialect struct {
+	// Placeholder returns the query parameter placeholder for the n-th
+	// argument (counting from 1), e.g. "$1" or "?".
+	Placeholder func(n int) string
+
+	// Returning is true if INSERT and UPDATE statements support a
+	// "RETURNING *" clause. Otherwise rows are re-read after being written.
+	Returning bool
+
+	// EmulateNulls is true if ORDER BY does not support the NULLS FIRST/LAST
+	// syntax (see OrderByClause).
+	EmulateNulls bool
+
+	// DefaultValues is used instead of the column and VALUES lists to insert
+	// a row using only default values, e.g. "DEFAULT VALUES".
+	DefaultValues string
+
+	// SearchJoin optionally returns a JOIN clause restricting results to the
+	// rows matching the "_search" terms in opts using the table's
+	// FullTextIndex, the arguments it uses (numbered from nargs+1), and an
+	// expression to rank the results by relevance. It returns an empty
+	// clause if there is nothing to search.
+	SearchJoin func(tab Table, opts map[string][]string, nargs int) (join string, args []interface{}, rank string)
+}
+
+// SQLModel implements the Model and Driver interfaces (along with Counter,
+// Iterator, Aggregator, TreeWalker and RawDriver) for a database/sql
+// connection, using the Dialect for database-specific syntax.
+type SQLModel struct {
+	conn    *sql.DB
+	dialect Dialect
+
+	tabs map[string]Table
+}
+
+// NewSQLModel returns a SQLModel for the tables of the database conn.
+func NewSQLModel(conn *sql.DB, dialect Dialect, tabs map[string]Table) *SQLModel {
+	return &SQLModel{conn: conn, dialect: dialect, tabs: tabs}
+}
+
+func (m *SQLModel) QueryPlaceholders(args ...interface{}) []string {
+	res := make([]string, len(args))
+	for i := range args {
+		res[i] = m.dialect.Placeholder(i + 1)
+	}
+	return res
+}
+
+func (m *SQLModel) Query(sql99 string, args ...interface{}) (*sql.Rows, error) {
+	return m.conn.Query(sql99, args...)
+}
+
+func (m *SQLModel) ListTableNames() []string {
+	var res []string
+	for tn := range m.tabs {
+		res = append(res, tn)
+	}
+	return res
+}
+
+func (m *SQLModel) GetTable(t string) Table {
+	tab, ok := m.tabs[t]
+	if ok {
+		tab.Driver = m
+		return tab
+	}
+	return Table{}
+}
+
+func (m *SQLModel) ListRelatedTableNames(t string) []string {
+	tab, ok := m.tabs[t]
+	if !ok {
+		return nil
+	}
+	var res []string
+	rels := make(map[string]struct{})
+	for _, others := range tab.Linked {
+		for tn := range others {
+			if _, found := rels[tn]; !found {
+				res = append(res, tn)
+				rels[tn] = struct{}{}
+			}
+		}
+	}
+	for tn := range tab.RevLinked {
+		if _, found := rels[tn]; !found {
+			res = append(res, tn)
+			rels[tn] = struct{}{}
+		}
+	}
+	return res
+}
+
+func (m *SQLModel) GetRelatedTableMappings(t1, t2 string) map[ColumnSetString][]ColumnSet {
+	tab, ok := m.tabs[t1]
+	otherTab, ok2 := m.tabs[t2]
+	if !ok || !ok2 {
+		return nil
+	}
+	res := make(map[ColumnSetString][]ColumnSet)
+
+	if len(tab.Linked) > 0 {
+		for fromCols, others := range tab.Linked {
+			res[fromCols] = append(res[fromCols], others[t2]...)
+		}
+	}
+	if len(tab.RevLinked) > 0 {
+		if _, isReverse := tab.RevLinked[t2]; isReverse {
+			for destCols, others := range otherTab.Linked {
+				toCols := StringAsColumnSet(destCols)
+				for _, srcCols := range others[t1] {
+					fromCols := ColumnSetAsString(srcCols)
+					res[fromCols] = append(res[fromCols], toCols)
+				}
+			}
+		}
+	}
+	return res
+}
+
+// getData scans the current row into a map, converting each value to the
+// native JSON type for its column in tab.
+func getData(tab Table, rows *sql.Rows) (map[string]interface{}, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		log.Println("err columns", err)
+		return nil, err
+	}
+
+	vals := make([]interface{}, len(cols))
+	args := make([]interface{}, len(cols))
+	for i := range cols {
+		args[i] = &vals[i]
+	}
+
+	/////
+	err = rows.Scan(args...)
+	if err != nil {
+		log.Println("err scan", err)
+		return nil, err
+	}
+
+	data := make(map[string]interface{})
+	for i, val := range vals {
+		data[cols[i]] = tab.ColumnInfo[cols[i]].Value(val)
+	}
+	return data, nil
+}
+
+// queryRows runs the query and returns all of the resulting rows, typed
+// using the ColumnInfo of tab.
+func (m *SQLModel) queryRows(tab Table, squery string, args []interface{}) ([]interface{}, error) {
+	rows, err := m.conn.Query(squery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]interface{}, 0)
+	for rows.Next() {
+		data, err := getData(tab, rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, data)
+	}
+	return res, rows.Err()
+}
+
+// querier is implemented by *sql.DB and *sql.Tx.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// queryRow runs the query and returns the first resulting row, or
+// ErrNotFound if there is none.
+func queryRow(q querier, tab Table, squery string, args []interface{}) (map[string]interface{}, error) {
+	rows, err := q.Query(squery, args...)
+	var data map[string]interface{}
+	if err == nil {
+		if rows.Next() {
+			data, err = getData(tab, rows)
+		} else {
+			// e.g. a failed INSERT ... RETURNING is reported here
+			err = rows.Err()
+		}
+		rows.Close()
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if data == nil {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+// searchJoin returns the Dialect's full-text search JOIN clause for opts,
+// if any, along with its arguments and ranking expression.
+func (m *SQLModel) searchJoin(tab Table, opts map[string][]string, nargs int) (string, []interface{}, string) {
+	if m.dialect.SearchJoin == nil {
+		return "", nil, ""
+	}
+	return m.dialect.SearchJoin(tab, opts, nargs)
+}
+
+func (m *SQLModel) Listing(tab Table, opts map[string][]string) ([]interface{}, error) {
+	_, perPage := Pagination(opts)
+	res := make([]interface{}, 0, perPage)
+	err := m.Each(tab, opts, func(row map[string]interface{}) error {
+		res = append(res, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = NestLinkedPaths(res, tab, opts["_nest"], m.GetTable, m.dialect.Placeholder, m.Listing)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Each calls fn with each row of the Listing results for opts, as they are
+// scanned. If fn returns an error, iteration stops and the error is returned.
+// If the "_unlimited" option is given, all results are returned without
+// pagination.
+//
+// Linked data is not included, as it must be fetched in batches by Listing.
+func (m *SQLModel) Each(tab Table, opts map[string][]string, fn func(row map[string]interface{}) error) error {
+	where, args, err := tab.WhereClause(opts, m.dialect.Placeholder)
+	if err != nil {
+		return err
+	}
+	_, perPage := Pagination(opts)
+	offset, err := PageOffset(opts)
+	if err != nil {
+		return err
+	}
+
+	sortFields, err := tab.SortFields(opts)
+	if err != nil {
+		return err
+	}
+	if cur, ok := opts["_cursor"]; ok && len(cur) > 0 {
+		// keyset pagination replaces the page offset
+		if !tab.IsSeekable(sortFields) {
+			return fmt.Errorf("%w: _cursor can only be used to sort by fields without empty values, "+
+				"and without _nulls, :nullsfirst or :nullslast", ErrInvalidFilter)
+		}
+		clause, cargs, err := tab.CursorClause(cur[0], sortFields, len(args), m.dialect.Placeholder)
+		if err != nil {
+			return err
+		}
+		if where == "" {
+			where = " WHERE " + clause
+		} else {
+			where += " AND " + clause
+		}
+		args = append(args, cargs...)
+		offset = 0
+	}
+
+	sortCols := make([]string, len(sortFields))
+	for i, sf := range sortFields {
+		sortCols[i] = sf.Column
+	}
+	// sort columns are needed to create the next cursor,
+	// and foreign key columns to include linked data
+	extra := append(sortCols, tab.LinkedColumns(opts["_nest"]...)...)
+	cols, err := tab.SelectColumns(opts, extra...)
+	if err != nil {
+		return err
+	}
+
+	sortKey := OrderByClause(sortFields, m.dialect.EmulateNulls)
+	from := tab.Name
+	if join, sargs, rank := m.searchJoin(tab, opts, len(args)); join != "" {
+		from += join
+		args = append(args, sargs...)
+		if cols == "*" {
+			cols = tab.Name + ".*"
+		}
+		// rank by relevance, unless another order was requested
+		if tab.IsRankedSearch(opts) {
+			sortKey = rank + ", " + sortKey
+		}
+	}
+	if dist := tab.DistanceOrder(opts); dist != "" {
+		sortKey = dist + ", " + sortKey
+	}
+
+	queryString := "SELECT " + cols + " FROM " + from + where
+	queryString += " ORDER BY " + sortKey
+	if _, all := opts["_unlimited"]; !all {
+		queryString += fmt.Sprintf(" LIMIT %d OFFSET %d", perPage, offset)
+	}
+	//log.Println(queryString, args)
+	rows, err := m.conn.Query(queryString, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		data, err := getData(tab, rows)
+		if err != nil {
+			return err
+		}
+		if err = fn(data); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Count returns the total number of rows matching the Listing filters in opts.
+func (m *SQLModel) Count(tab Table, opts map[string][]string) (int, error) {
+	where, args, err := tab.WhereClause(opts, m.dialect.Placeholder)
+	if err != nil {
+		return 0, err
+	}
+	join, sargs, _ := m.searchJoin(tab, opts, len(args))
+	args = append(args, sargs...)
+	n := 0
+	err = m.conn.QueryRow("SELECT COUNT(*) FROM "+tab.Name+join+where, args...).Scan(&n)
+	return n, err
+}
+
+// Aggregate returns the grouped aggregates for the rows matching the Listing
+// filters in opts.
+func (m *SQLModel) Aggregate(tab Table, opts map[string][]string) ([]interface{}, error) {
+	sel, groupBy, info, err := tab.AggregateClauses(opts)
+	if err != nil {
+		return nil, err
+	}
+	where, args, err := tab.WhereClause(opts, m.dialect.Placeholder)
+	if err != nil {
+		return nil, err
+	}
+	join, sargs, _ := m.searchJoin(tab, opts, len(args))
+	args = append(args, sargs...)
+	_, perPage := Pagination(opts)
+	offset, err := PageOffset(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	queryString := "SELECT " + sel + " FROM " + tab.Name + join + where + groupBy
+	queryString += fmt.Sprintf(" LIMIT %d OFFSET %d", perPage, offset)
+
+	// results are typed using the aggregates' column info
+	aggTab := tab
+	aggTab.ColumnInfo = info
+	res, err := m.queryRows(aggTab, queryString, args)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range res {
+		AggregateRow(row.(map[string]interface{}))
+	}
+	return res, nil
+}
+
+// Tree lists the ancestors (if up is true) or descendants of the row of tab
+// with the key values, using the self-referencing relation rel.
+func (m *SQLModel) Tree(tab Table, rel Relation, up bool, key []string, maxDepth int, opts map[string][]string) ([]interface{}, error) {
+	squery, args, err := tab.TreeQuery(rel, up, key, maxDepth, opts, m.dialect.Placeholder)
+	if err != nil {
+		return nil, err
+	}
+	treeTab := tab
+	treeTab.ColumnInfo = tab.TreeColumnInfo()
+	return m.queryRows(treeTab, squery, args)
+}
+
+func (m *SQLModel) Get(tab Table, opts map[string][]string) (map[string]interface{}, error) {
+	var where []string
+	var args []interface{}
+	for colname, vals := range opts {
+		if colname[:1] == "_" {
+			continue
+		}
+		args = append(args, vals[0])
+		where = append(where, colname+"="+m.dialect.Placeholder(len(args)))
+	}
+	// foreign key columns are needed to include the linked data
+	cols, err := tab.SelectColumns(opts, tab.LinkedColumns(opts["_nest"]...)...)
+	if err != nil {
+		return nil, err
+	}
+	squery := "SELECT " + cols + " FROM " + tab.Name
+	if len(where) > 0 {
+		squery += " WHERE " + strings.Join(where, " AND ")
+	}
+	// closing the rows would otherwise drain the entire result set
+	squery += " LIMIT 1"
+	data, err := queryRow(m.conn, tab, squery, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if nestData, ok := opts["_nest"]; ok && len(nestData) > 0 {
+		if tab.Linked == nil && tab.RevLinked == nil {
+			// errors.New("invalid nest value(s): " + strings.Join(nestData, ", "))
+			return nil, ErrInvalidInclude
+		}
+		err = NestLinkedPaths([]interface{}{data}, tab, nestData, m.GetTable, m.dialect.Placeholder, m.Listing)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return data, err
+}
+
+func (m *SQLModel) Delete(tab Table, opts map[string][]string) error {
+	var where []string
+	var args []interface{}
+	for _, colname := range tab.Key {
+		args = append(args, opts[colname][0])
+		where = append(where, colname+"="+m.dialect.Placeholder(len(args)))
+	}
+	squery := "DELETE FROM " + tab.Name
+	if len(where) > 0 {
+		squery += " WHERE " + strings.Join(where, " AND ")
+	} else {
+		// invalid LACK OF a filter...
+		return ErrInvalidFilter
+	}
+
+	res, err := m.conn.Exec(squery, args...)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		log.Println(err)
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Update modifies the row, and returns it using a RETURNING clause or else by
+// re-reading it by primary key.
+func (m *SQLModel) Update(tab Table, opts map[string][]string) (interface{}, error) {
+	var sets, where []string
+	var args []interface{}
+	keyOpts := make(map[string][]string)
+	for _, colname := range tab.Columns {
+		if _, ok := opts[colname]; !ok || tab.Key.Contains(colname) {
+			continue
+		}
+		args = append(args, tab.ColumnArg(colname, opts))
+		sets = append(sets, colname+"="+m.dialect.Placeholder(len(args)))
+	}
+	for _, colname := range tab.Key {
+		args = append(args, opts[colname][0])
+		where = append(where, colname+"="+m.dialect.Placeholder(len(args)))
+		keyOpts[colname] = opts[colname][:1]
+	}
+	if len(sets) == 0 {
+		return m.Get(tab, keyOpts)
+	}
+
+	squery := "UPDATE " + tab.Name + " SET " + strings.Join(sets, ", ")
+	squery += " WHERE " + strings.Join(where, " AND ")
+	if m.dialect.Returning {
+		return queryRow(m.conn, tab, squery+" RETURNING *", args)
+	}
+
+	// NB RowsAffected is 0 when no values changed, so the re-read
+	// below is used to detect missing rows instead.
+	_, err := m.conn.Exec(squery, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return m.Get(tab, keyOpts)
+}
+
+// Insert creates the row, and returns it using a RETURNING clause or else by
+// re-reading it in the same transaction, using the provided primary key
+// values or the last insert ID of an AutoIncrement key.
+//
+// Rows without a primary key cannot be found reliably (e.g. by comparing
+// floating point values), so the inserted values are returned instead,
+// along with NULL for the columns without a default value.
+//
+// If the row could not be re-read, nothing is inserted and ErrInsertFailed
+// is returned.
+func (m *SQLModel) Insert(tab Table, opts map[string][]string) (interface{}, error) {
+	var colnames []string
+	var placeholders []string
+	var args []interface{}
+	for _, colname := range tab.Columns {
+		if x, ok := opts[colname]; ok && len(x) > 0 {
+			colnames = append(colnames, colname)
+			args = append(args, tab.ColumnArg(colname, opts))
+			placeholders = append(placeholders, m.dialect.Placeholder(len(args)))
+		}
+	}
+	squery := "INSERT INTO " + tab.Name + " " + m.dialect.DefaultValues
+	if len(colnames) > 0 {
+		squery = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+			tab.Name, strings.Join(colnames, ","), strings.Join(placeholders, ","))
+	}
+	if m.dialect.Returning {
+		return queryRow(m.conn, tab, squery+" RETURNING *", args)
+	}
+
+	// check that the new row can be found before inserting it
+	var missing []string
+	for _, colname := range tab.Key {
+		if _, ok := opts[colname]; !ok {
+			missing = append(missing, colname)
+		}
+	}
+	useInsertID := len(missing) == 1 && len(tab.Key) == 1 && tab.ColumnInfo[missing[0]].AutoIncrement
+	if len(missing) > 0 && !useInsertID {
+		return nil, fmt.Errorf("%w: missing values for %s", ErrInsertFailed, strings.Join(missing, ", "))
+	}
+	if len(tab.Key) == 0 {
+		if len(colnames) == 0 {
+			return nil, fmt.Errorf("%w: no values given", ErrInsertFailed)
+		}
+		if _, err := m.conn.Exec(squery, args...); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		data := make(map[string]interface{}, len(tab.Columns))
+		for _, colname := range tab.Columns {
+			ci := tab.ColumnInfo[colname]
+			if !ci.Default.Valid && !ci.AutoIncrement {
+				data[colname] = nil
+			}
+		}
+		for i, colname := range colnames {
+			data[colname] = tab.ColumnInfo[colname].Value(args[i])
+		}
+		return data, nil
+	}
+
+	tx, err := m.conn.Begin()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	res, err := tx.Exec(squery, args...)
+	if err != nil {
+		log.Println(err)
+		tx.Rollback()
+		return nil, err
+	}
+
+	var where []string
+	var wargs []interface{}
+	match := func(colname string, val interface{}) {
+		if val == nil {
+			where = append(where, colname+" IS NULL")
+			return
+		}
+		wargs = append(wargs, val)
+		where = append(where, colname+"="+m.dialect.Placeholder(len(wargs)))
+	}
+	if useInsertID {
+		id, err := res.LastInsertId()
+		if err != nil {
+			log.Println(err)
+			tx.Rollback()
+			return nil, err
+		}
+		match(tab.Key[0], id)
+	} else {
+		for _, colname := range tab.Key {
+			match(colname, tab.ColumnArg(colname, opts))
+		}
+	}
+
+	data, err := queryRow(tx, tab, "SELECT * FROM "+tab.Name+" WHERE "+strings.Join(where, " AND ")+" LIMIT 1", wargs)
+	if err == ErrNotFound {
+		err = ErrInsertFailed
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println(err)
+		tx.Rollback()
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetSubqueryMapping adds a "_where" condition to opts to list the rows of
+// table2 linked to the row of table1 with the key values, optionally only
+// using the via columns of table2.
+func (m *SQLModel) GetSubqueryMapping(table1, table2 Table, via ColumnSet, key []string, opts map[string][]string) {
+	colmaps := m.GetRelatedTableMappings(table1.Name, table2.Name)
+	where, args := SubqueryClause(table1, table2, colmaps, via, key, len(opts["_args"]), m.dialect.Placeholder)
+	if where != "" {
+		opts["_where"] = append(opts["_where"], where)
+		opts["_args"] = append(opts["_args"], args...)
+	}
+}
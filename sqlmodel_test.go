@@ -0,0 +1,374 @@
+package bdog
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// TestInsertWithoutReturning checks that rows inserted without a RETURNING
+// clause (as for MySQL) are re-read, or else not inserted at all.
+func TestInsertWithoutReturning(t *testing.T) {
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "insert.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.Exec(`
+		CREATE TABLE items (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, qty INTEGER DEFAULT 1);
+		CREATE TABLE codes (code TEXT PRIMARY KEY DEFAULT 'x', name TEXT);
+		CREATE TABLE pairs (a INTEGER, b INTEGER, PRIMARY KEY (a, b));
+		CREATE TABLE events (name TEXT, qty INTEGER DEFAULT 7, price REAL);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := ColumnInfo{SQLType: "TEXT", Type: TextType}
+	integer := ColumnInfo{SQLType: "INTEGER", Type: IntegerType}
+	tabs := map[string]Table{
+		"items": {Name: "items", Columns: ColumnSet{"id", "name", "qty"}, Key: ColumnSet{"id"},
+			ColumnInfo: map[string]ColumnInfo{"id": {SQLType: "INTEGER", Type: IntegerType, AutoIncrement: true}, "name": text, "qty": integer}},
+		"codes": {Name: "codes", Columns: ColumnSet{"code", "name"}, Key: ColumnSet{"code"},
+			ColumnInfo: map[string]ColumnInfo{"code": text, "name": text}},
+		"pairs": {Name: "pairs", Columns: ColumnSet{"a", "b"}, Key: ColumnSet{"a", "b"},
+			ColumnInfo: map[string]ColumnInfo{"a": integer, "b": integer}},
+		"events": {Name: "events", Columns: ColumnSet{"name", "qty", "price"},
+			ColumnInfo: map[string]ColumnInfo{"name": text, "price": {SQLType: "REAL", Type: RealType},
+				"qty": {SQLType: "INTEGER", Type: IntegerType, Default: sql.NullString{String: "7", Valid: true}}}},
+	}
+	m := NewSQLModel(conn, Dialect{
+		Placeholder:   func(int) string { return "?" },
+		DefaultValues: "DEFAULT VALUES",
+	}, tabs)
+
+	for _, tc := range []struct {
+		table   string
+		opts    map[string][]string
+		want    map[string]interface{}
+		wantErr error
+	}{
+		{"items", map[string][]string{"name": {"bolt"}}, map[string]interface{}{"id": int64(1), "name": "bolt", "qty": int64(1)}, nil},
+		{"items", map[string][]string{"name": {"nut"}, "qty": {"3"}}, map[string]interface{}{"id": int64(2), "name": "nut", "qty": int64(3)}, nil},
+		{"codes", map[string][]string{"name": {"default key"}}, nil, ErrInsertFailed},
+		{"codes", map[string][]string{"code": {"y"}, "name": {"given key"}}, map[string]interface{}{"code": "y", "name": "given key"}, nil},
+		{"pairs", map[string][]string{"a": {"1"}}, nil, ErrInsertFailed},
+		{"pairs", map[string][]string{"a": {"1"}, "b": {"2"}}, map[string]interface{}{"a": int64(1), "b": int64(2)}, nil},
+		{"events", map[string][]string{"name": {"start"}}, map[string]interface{}{"name": "start", "price": nil}, nil},
+		{"events", map[string][]string{"name": {""}, "_null": {"name"}}, map[string]interface{}{"name": nil, "price": nil}, nil},
+		{"events", map[string][]string{"name": {"sale"}, "qty": {"2"}, "price": {"0.1"}}, map[string]interface{}{"name": "sale", "qty": int64(2), "price": 0.1}, nil},
+		{"events", map[string][]string{"name": {"sale"}, "price": {"0.1"}}, map[string]interface{}{"name": "sale", "price": 0.1}, nil},
+	} {
+		res, err := m.Insert(m.GetTable(tc.table), tc.opts)
+		if tc.wantErr != nil {
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("%s %v: got error %v, want %v", tc.table, tc.opts, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %v: %v", tc.table, tc.opts, err)
+			continue
+		}
+		data := res.(map[string]interface{})
+		if len(data) != len(tc.want) {
+			t.Errorf("%s %v = %v, want %v", tc.table, tc.opts, data, tc.want)
+		}
+		for k, v := range tc.want {
+			if data[k] != v {
+				t.Errorf("%s %v = %v, want %v", tc.table, tc.opts, data, tc.want)
+				break
+			}
+		}
+	}
+
+	// failed inserts must not leave rows behind
+	for table, want := range map[string]int{"codes": 1, "pairs": 1} {
+		n := 0
+		if err = conn.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("%s has %d rows, want %d", table, n, want)
+		}
+	}
+}
+
+// TestAggregateGroupedByCount checks that grouping by a column named like an
+// aggregate keeps both values apart.
+func TestAggregateGroupedByCount(t *testing.T) {
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "aggregate.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.Exec(`
+		CREATE TABLE tallies (id INTEGER PRIMARY KEY, count INTEGER);
+		INSERT INTO tallies (count) VALUES (5), (5), (9);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	integer := ColumnInfo{SQLType: "INTEGER", Type: IntegerType}
+	m := NewSQLModel(conn, Dialect{Placeholder: func(int) string { return "?" }}, map[string]Table{
+		"tallies": {Name: "tallies", Columns: ColumnSet{"id", "count"}, Key: ColumnSet{"id"},
+			ColumnInfo: map[string]ColumnInfo{"id": integer, "count": integer}},
+	})
+
+	for _, tc := range []struct {
+		opts map[string][]string
+		want []map[string]interface{}
+	}{
+		{map[string][]string{"_group": {"count"}, "_aggregate": {"count:*"}, "_sortby": {"count"}}, []map[string]interface{}{
+			{"count": int64(5), "_agg_count": int64(2)},
+			{"count": int64(9), "_agg_count": int64(1)},
+		}},
+		{map[string][]string{"_group": {"count"}, "_aggregate": {"sum:id"}, "_sortby": {"count"}}, []map[string]interface{}{
+			{"count": int64(5), "sum_id": int64(3)},
+			{"count": int64(9), "sum_id": int64(3)},
+		}},
+		{map[string][]string{"_aggregate": {"count:*"}}, []map[string]interface{}{
+			{"count": int64(3)},
+		}},
+	} {
+		res, err := m.Aggregate(m.GetTable("tallies"), tc.opts)
+		if err != nil {
+			t.Errorf("%v: %v", tc.opts, err)
+			continue
+		}
+		if len(res) != len(tc.want) {
+			t.Errorf("%v = %v, want %v", tc.opts, res, tc.want)
+			continue
+		}
+		for i, row := range res {
+			if !reflect.DeepEqual(row, tc.want[i]) {
+				t.Errorf("%v row %d = %v, want %v", tc.opts, i, row, tc.want[i])
+			}
+		}
+	}
+}
+
+// TestListingNear checks that results ordered by distance from "_near" list
+// the rows without coordinates last.
+func TestListingNear(t *testing.T) {
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "geo.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.Exec(`
+		CREATE TABLE airports (ident TEXT PRIMARY KEY, latitude_deg REAL, longitude_deg REAL);
+		INSERT INTO airports VALUES ('KATL', 33.64, -84.43), ('X1', NULL, NULL),
+			('KCLT', 35.21, -80.94), ('X2', 35.2, NULL), ('KRDU', 35.88, -78.79);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := ColumnInfo{SQLType: "TEXT", Type: TextType}
+	real := ColumnInfo{SQLType: "REAL", Type: RealType}
+	m := NewSQLModel(conn, Dialect{Placeholder: func(int) string { return "?" }}, map[string]Table{
+		"airports": {Name: "airports", Columns: ColumnSet{"ident", "latitude_deg", "longitude_deg"}, Key: ColumnSet{"ident"},
+			ColumnInfo: map[string]ColumnInfo{"ident": text, "latitude_deg": real, "longitude_deg": real}},
+	})
+
+	for _, tc := range []struct {
+		opts map[string][]string
+		want []string
+	}{
+		{map[string][]string{"_near": {"35.2,-80.9"}}, []string{"KCLT", "KRDU", "KATL", "X1", "X2"}},
+		{map[string][]string{"_near": {"35.2,-80.9"}, "_perpage": {"2"}}, []string{"KCLT", "KRDU"}},
+		{map[string][]string{"_near": {"35.2,-80.9"}, "_radius_km": {"500"}}, []string{"KCLT", "KRDU", "KATL"}},
+	} {
+		res, err := m.Listing(m.GetTable("airports"), tc.opts)
+		if err != nil {
+			t.Errorf("%v: %v", tc.opts, err)
+			continue
+		}
+		got := make([]string, len(res))
+		for i, row := range res {
+			got[i], _ = row.(map[string]interface{})["ident"].(string)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v = %v, want %v", tc.opts, got, tc.want)
+		}
+	}
+}
+
+// TestCursorPaging checks the keyset pagination conditions, and that following
+// the next cursor through a table lists every row exactly once.
+func TestCursorPaging(t *testing.T) {
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "cursor.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.Exec(`
+		CREATE TABLE parts (grp INTEGER, seq INTEGER, price REAL NOT NULL, active BOOLEAN NOT NULL, note TEXT,
+			PRIMARY KEY (grp, seq));
+		INSERT INTO parts VALUES (1, 1, 2.5, 1, NULL), (1, 2, 10, 0, 'x'), (1, 3, 2.5, 0, NULL),
+			(2, 1, 0.75, 1, 'y'), (2, 2, 10, 1, NULL), (2, 3, 1e6, 0, NULL), (3, 1, 2.5, 1, 'z');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	integer := ColumnInfo{SQLType: "INTEGER", Type: IntegerType, NotNull: true}
+	tab := Table{Name: "parts", Columns: ColumnSet{"grp", "seq", "price", "active", "note"}, Key: ColumnSet{"grp", "seq"},
+		ColumnInfo: map[string]ColumnInfo{"grp": integer, "seq": integer,
+			"price":  {SQLType: "REAL", Type: RealType, NotNull: true},
+			"active": {SQLType: "BOOLEAN", Type: BooleanType, NotNull: true},
+			"note":   {SQLType: "TEXT", Type: TextType}}}
+	m := NewSQLModel(conn, Dialect{Placeholder: func(n int) string { return fmt.Sprint("$", n) }}, map[string]Table{"parts": tab})
+	tab = m.GetTable("parts")
+
+	cursor := func(vals string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(vals))
+	}
+	for _, tc := range []struct {
+		sortby string
+		cursor string
+		want   string
+		args   []interface{}
+	}{
+		{"", cursor(`[1,2]`), "(grp, seq) > ($3, $4)", []interface{}{"1", "2"}},
+		{"-grp,-seq", cursor(`[1,2]`), "(grp, seq) < ($3, $4)", []interface{}{"1", "2"}},
+		{"-price", cursor(`[2.5,1,3]`), "((price < $3) OR (price = $4 AND grp > $5) OR (price = $6 AND grp = $7 AND seq > $8))",
+			[]interface{}{"2.5", "2.5", "1", "2.5", "1", "3"}},
+		{"active", cursor(`[true,2,1]`), "(active, grp, seq) > ($3, $4, $5)", []interface{}{int64(1), "2", "1"}},
+	} {
+		fields, err := tab.SortFields(map[string][]string{"_sortby": {tc.sortby}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		clause, args, err := tab.CursorClause(tc.cursor, fields, 2, m.dialect.Placeholder)
+		if err != nil {
+			t.Errorf("%q: %v", tc.sortby, err)
+			continue
+		}
+		if clause != tc.want || !reflect.DeepEqual(args, tc.args) {
+			t.Errorf("%q = %q %#v, want %q %#v", tc.sortby, clause, args, tc.want, tc.args)
+		}
+	}
+
+	for _, tc := range []struct {
+		opts map[string][]string
+	}{
+		{map[string][]string{"_cursor": {cursor(`[null,1]`)}}},
+		{map[string][]string{"_cursor": {cursor(`[1]`)}}},
+		{map[string][]string{"_cursor": {"not a cursor"}}},
+		{map[string][]string{"_cursor": {cursor(`[null,1,1]`)}, "_sortby": {"note"}}},
+		{map[string][]string{"_cursor": {cursor(`[1,1]`)}, "_sortby": {"grp"}, "_nulls": {"last"}}},
+	} {
+		if _, err := m.Listing(tab, tc.opts); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("%v: got error %v, want ErrInvalidFilter", tc.opts, err)
+		}
+	}
+
+	for _, sortby := range []string{"", "-grp,-seq", "-price", "price,-seq", "active,price", "-active,seq"} {
+		all, err := m.Listing(tab, map[string][]string{"_sortby": {sortby}, "_unlimited": {""}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields, err := tab.SortFields(map[string][]string{"_sortby": {sortby}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []interface{}
+		opts := map[string][]string{"_sortby": {sortby}, "_perpage": {"2"}}
+		for page := 0; page < len(all); page++ {
+			res, err := m.Listing(tab, opts)
+			if err != nil {
+				t.Fatalf("%q page %d: %v", sortby, page, err)
+			}
+			got = append(got, res...)
+			if len(res) < 2 {
+				break
+			}
+			opts["_cursor"] = []string{NextCursor(fields, res[len(res)-1].(map[string]interface{}))}
+		}
+		if !reflect.DeepEqual(got, all) {
+			t.Errorf("%q: paged = %v, want %v", sortby, got, all)
+		}
+	}
+}
+
+// TestInsertReturningError checks that errors from a RETURNING clause are not
+// reported as missing rows.
+func TestInsertReturningError(t *testing.T) {
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "returning.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.Exec(`CREATE TABLE codes (code TEXT PRIMARY KEY, name TEXT NOT NULL);
+		INSERT INTO codes VALUES ('x', 'first');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := ColumnInfo{SQLType: "TEXT", Type: TextType}
+	m := NewSQLModel(conn, Dialect{
+		Placeholder: func(int) string { return "?" },
+		Returning:   true,
+	}, map[string]Table{
+		"codes": {Name: "codes", Columns: ColumnSet{"code", "name"}, Key: ColumnSet{"code"},
+			ColumnInfo: map[string]ColumnInfo{"code": text, "name": text}},
+	})
+
+	for _, opts := range []map[string][]string{
+		{"code": {"x"}, "name": {"duplicate"}},
+		{"code": {"y"}, "name": {""}, "_null": {"name"}},
+	} {
+		_, err := m.Insert(m.GetTable("codes"), opts)
+		if err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("%v: got error %v, want a constraint error", opts, err)
+		}
+	}
+}
+
+// TestUpdateWithoutReturning checks that rows updated without a RETURNING
+// clause (as for MySQL) are re-read the same as with one.
+func TestUpdateWithoutReturning(t *testing.T) {
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "update.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.Exec(`
+		CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT, price REAL, active BOOLEAN);
+		INSERT INTO items VALUES (1, 'bolt', 0.25, 0), (2, 'nut', 0.1, 1);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tabs := map[string]Table{
+		"items": {Name: "items", Columns: ColumnSet{"id", "name", "price", "active"}, Key: ColumnSet{"id"},
+			ColumnInfo: map[string]ColumnInfo{"id": {SQLType: "INTEGER", Type: IntegerType}, "name": {SQLType: "TEXT", Type: TextType},
+				"price": {SQLType: "REAL", Type: RealType}, "active": {SQLType: "BOOLEAN", Type: BooleanType}}},
+	}
+	placeholder := func(int) string { return "?" }
+	returning := NewSQLModel(conn, Dialect{Placeholder: placeholder, Returning: true}, tabs)
+	rereading := NewSQLModel(conn, Dialect{Placeholder: placeholder}, tabs)
+
+	for _, opts := range []map[string][]string{
+		{"id": {"1"}, "price": {"0.3"}, "active": {"true"}},
+		{"id": {"2"}, "name": {""}, "_null": {"name"}},
+		{"id": {"2"}},
+	} {
+		want, err := returning.Update(returning.GetTable("items"), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := rereading.Update(rereading.GetTable("items"), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v = %v, want %v", opts, got, want)
+		}
+	}
+	for _, m := range []*SQLModel{returning, rereading} {
+		_, err := m.Update(m.GetTable("items"), map[string][]string{"id": {"3"}, "name": {"x"}})
+		if err != ErrNotFound {
+			t.Errorf("missing row: got error %v, want ErrNotFound", err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package bdog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultTreeDepth is the default number of levels of ancestors or
+// descendants returned by tree queries.
+const DefaultTreeDepth = 10
+
+// TreeQuery builds a recursive query (using a common table expression) for the
+// rows of the table linked to the row with the key values by rel, a
+// self-referencing to-one relation (e.g. "parent"): the row's ancestors if up
+// is true (its parent, the parent's parent, and so on), or otherwise its
+// descendants. Rows up to maxDepth levels away are returned, nearest first,
+// with their level in a "_depth" column. The "_fields", "_page" and "_perpage"
+// options are used.
+//
+// Unknown fields or pages that are too large result in an ErrInvalidFilter
+// error.
+func (t *Table) TreeQuery(rel Relation, up bool, key []string, maxDepth int, opts map[string][]string,
+	placeholder func(n int) string) (string, []interface{}, error) {
+	fields, err := t.FieldList(opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var start, join []string
+	var args []interface{}
+	for i, kc := range t.Key {
+		args = append(args, key[i])
+		start = append(start, kc+"="+placeholder(len(args)))
+		if up {
+			join = append(join, "_next."+kc+"=_tree."+rel.Columns[i])
+		} else {
+			join = append(join, "_next."+rel.Columns[i]+"=_tree."+kc)
+		}
+	}
+	next := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		next[i] = "_next." + col
+	}
+	_, perPage := Pagination(opts)
+	offset, err := PageOffset(opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	cols := strings.Join(t.Columns, ", ")
+	squery := "WITH RECURSIVE _tree (" + cols + ", _depth) AS (" +
+		"SELECT " + cols + ", 0 FROM " + t.Name + " WHERE " + strings.Join(start, " AND ") +
+		" UNION ALL SELECT " + strings.Join(next, ", ") + ", _tree._depth+1 FROM " + t.Name + " AS _next" +
+		" JOIN _tree ON " + strings.Join(join, " AND ") + fmt.Sprintf(" WHERE _tree._depth < %d)", maxDepth) +
+		" SELECT " + strings.Join(fields, ", ") + ", _depth FROM _tree WHERE _depth > 0" +
+		" ORDER BY _depth, " + strings.Join(t.Key, ", ") +
+		fmt.Sprintf(" LIMIT %d OFFSET %d", perPage, offset)
+	return squery, args, nil
+}
+
+// TreeColumnInfo returns the ColumnInfo for the results of TreeQuery.
+func (t *Table) TreeColumnInfo() map[string]ColumnInfo {
+	info := make(map[string]ColumnInfo, len(t.ColumnInfo)+1)
+	for col, ci := range t.ColumnInfo {
+		info[col] = ci
+	}
+	info["_depth"] = ColumnInfo{SQLType: "INTEGER", Type: IntegerType}
+	return info
+}